@@ -0,0 +1,56 @@
+package authz_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	policy := authz.DefaultPolicy()
+	allowed := map[authz.Role][]bool{
+		authz.RoleUser:      {true, false, false},
+		authz.RoleModerator: {true, true, false},
+		authz.RoleAdmin:     {true, true, true},
+		authz.RoleBanned:    {false, false, false},
+	}
+	permissions := []authz.Permission{
+		authz.PermissionPlay,
+		authz.PermissionManageRooms,
+		authz.PermissionAdmin,
+	}
+	for role, expected := range allowed {
+		for i, permission := range permissions {
+			err := policy.Authorize("1", role, permission)
+			if expected[i] {
+				assert.Nil(t, err, "%s with permission %d", role, permission)
+			} else {
+				assert.Equal(t, authz.ErrPermissionDenied, err, "%s with permission %d", role, permission)
+			}
+		}
+	}
+}
+
+func TestMemoryRoleStore(t *testing.T) {
+	store := authz.NewMemoryRoleStore()
+	assert.Equal(t, authz.RoleUser, store.Role("1"))
+
+	store.SetRole("1", authz.RoleBanned)
+	assert.Equal(t, authz.RoleBanned, store.Role("1"))
+
+	store.Replace(map[user.Id]authz.Role{"2": authz.RoleAdmin})
+	assert.Equal(t, authz.RoleUser, store.Role("1"))
+	assert.Equal(t, authz.RoleAdmin, store.Role("2"))
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := authz.ParseRole("moderator")
+	assert.Nil(t, err)
+	assert.Equal(t, authz.RoleModerator, role)
+
+	_, err = authz.ParseRole("superuser")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"errors"
+
+	"github.com/opentarock/service-api/go/user"
+)
+
+// ErrPermissionDenied is returned if a user is not allowed to perform an
+// operation.
+var ErrPermissionDenied = errors.New("Permission denied")
+
+// Permission is what an operation requires from the user performing it.
+type Permission int
+
+const (
+	// PermissionPlay allows a user to act on their own behalf, for example to
+	// join a room or to start the game in a room they own.
+	PermissionPlay Permission = iota
+	// PermissionManageRooms allows a user to perform owner actions in rooms
+	// they do not own.
+	PermissionManageRooms
+	// PermissionAdmin allows a user to manage the service.
+	PermissionAdmin
+)
+
+// Policy decides whether users are allowed to perform operations.
+type Policy interface {
+	// Authorize returns ErrPermissionDenied if the user with the given role
+	// does not have the permission.
+	Authorize(userId user.Id, role Role, permission Permission) error
+}
+
+// PolicyFunc is an adapter to allow the use of ordinary functions as
+// policies.
+type PolicyFunc func(userId user.Id, role Role, permission Permission) error
+
+func (f PolicyFunc) Authorize(userId user.Id, role Role, permission Permission) error {
+	return f(userId, role, permission)
+}
+
+// DefaultPolicy lets users play, moderators also manage all the rooms and
+// admins do everything. Banned users are refused all operations.
+func DefaultPolicy() Policy {
+	return PolicyFunc(func(userId user.Id, role Role, permission Permission) error {
+		switch role {
+		case RoleAdmin:
+			return nil
+		case RoleModerator:
+			if permission != PermissionAdmin {
+				return nil
+			}
+		case RoleUser:
+			if permission == PermissionPlay {
+				return nil
+			}
+		}
+		return ErrPermissionDenied
+	})
+}
@@ -0,0 +1,59 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Role determines which lobby operations a user is allowed to perform.
+type Role int
+
+const (
+	// RoleUser is the role of every user without an assigned role.
+	RoleUser Role = iota
+	RoleModerator
+	RoleAdmin
+	// RoleBanned is the role of users that are refused all operations.
+	RoleBanned
+)
+
+var roleNames = map[Role]string{
+	RoleUser:      "user",
+	RoleModerator: "moderator",
+	RoleAdmin:     "admin",
+	RoleBanned:    "banned",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns the role with the given name.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return RoleUser, fmt.Errorf("Unknown role: %s", name)
+}
+
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("Role must be a string: %s", err)
+	}
+	parsed, err := ParseRole(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
@@ -0,0 +1,60 @@
+package authz
+
+import (
+	"sync"
+
+	"github.com/opentarock/service-api/go/user"
+)
+
+// RoleStore looks up the roles of users.
+type RoleStore interface {
+	// Role returns the role of the user, RoleUser if the user has no
+	// assigned role.
+	Role(userId user.Id) Role
+}
+
+// MemoryRoleStore is a RoleStore keeping the roles in memory.
+type MemoryRoleStore struct {
+	roles map[user.Id]Role
+	lock  *sync.RWMutex
+}
+
+func NewMemoryRoleStore() *MemoryRoleStore {
+	return &MemoryRoleStore{
+		roles: make(map[user.Id]Role),
+		lock:  new(sync.RWMutex),
+	}
+}
+
+func (s *MemoryRoleStore) Role(userId user.Id) Role {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if role, ok := s.roles[userId]; ok {
+		return role
+	}
+	return RoleUser
+}
+
+// SetRole assigns a role to the user. Assigning RoleUser removes the user from
+// the store.
+func (s *MemoryRoleStore) SetRole(userId user.Id, role Role) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if role == RoleUser {
+		delete(s.roles, userId)
+	} else {
+		s.roles[userId] = role
+	}
+}
+
+// Replace replaces all the assigned roles with roles.
+func (s *MemoryRoleStore) Replace(roles map[user.Id]Role) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.roles = make(map[user.Id]Role, len(roles))
+	for userId, role := range roles {
+		if role != RoleUser {
+			s.roles[userId] = role
+		}
+	}
+}
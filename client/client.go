@@ -0,0 +1,81 @@
+// Package client sends requests to the HTTP/JSON gateway of the lobby
+// service. It is used by the command line tools, the nanomsg REQ/REP endpoint
+// can only be reached with the clients of service-api.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error is returned if the gateway refused a request, for example because
+// the user is not authenticated. Error codes of the lobby are part of the
+// response instead.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Gateway error %d: %s", e.Status, e.Message)
+}
+
+// Client is a client of the gateway. The zero value of HttpClient uses
+// http.DefaultClient.
+type Client struct {
+	// Url is the address of the gateway, for example http://localhost:8080.
+	Url string
+	// Header is sent with every request to authenticate the user, for
+	// example with an Authorization header holding the user's access token.
+	Header     http.Header
+	HttpClient *http.Client
+}
+
+// New returns a client of the gateway at url sending the header with every
+// request.
+func New(url string, header http.Header) *Client {
+	return &Client{Url: url, Header: header}
+}
+
+// BearerToken returns the header authenticating requests with the token.
+func BearerToken(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+// Request sends the request to the endpoint of the operation with the name,
+// for example create_room, and decodes the response into response.
+func (c *Client) Request(name string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(c.Url, "/") + "/lobby/" + name
+	httpRequest, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range c.Header {
+		httpRequest.Header[key] = values
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		return &Error{Status: resp.StatusCode, Message: errorResponse.Error}
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
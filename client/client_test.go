@@ -0,0 +1,58 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/client"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/service"
+)
+
+func makeGateway(t *testing.T) *httptest.Server {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	auth := service.BearerAuthenticator{Lookup: func(token string) (user.Id, bool) {
+		return user.Id(token), token != ""
+	}}
+	return httptest.NewServer(service.NewHttpHandler(handlers, auth))
+}
+
+func TestRequest(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+	c := client.New(server.URL, client.BearerToken("1"))
+
+	var created proto_lobby.CreateRoomResponse
+	err := c.Request("create_room", &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")}, &created)
+	assert.Nil(t, err)
+	assert.Equal(t, "room", created.GetRoom().GetName())
+	assert.Equal(t, "1", created.GetRoom().GetOwner())
+
+	var started proto_lobby.StartGameResponse
+	err = client.New(server.URL, client.BearerToken("2")).Request("start_game", &proto_lobby.StartGameRequest{}, &started)
+	assert.Nil(t, err)
+	assert.Equal(t, proto_lobby.StartGameResponse_NOT_IN_ROOM, started.GetErrorCode(), "Error codes are part of the response")
+}
+
+func TestRequestRefusedByGateway(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	err := client.New(server.URL, nil).Request("create_room", &proto_lobby.CreateRoomRequest{}, &created)
+	if assert.IsType(t, &client.Error{}, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.(*client.Error).Status)
+	}
+	err = client.New(server.URL, client.BearerToken("1")).Request("unknown", &proto_lobby.CreateRoomRequest{}, &created)
+	assert.IsType(t, &client.Error{}, err)
+}
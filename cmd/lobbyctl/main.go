@@ -0,0 +1,218 @@
+// Command lobbyctl sends requests to the lobby service for debugging.
+//
+// Usage:
+//
+//	lobbyctl [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	create <name>     create a room
+//	join <room-id>    join a room
+//	leave             leave the current room
+//	list              list the rooms
+//	info <room-id>    show a room
+//	start             start the game in the current room
+//	ready <state>     confirm being ready with the state from StartGameEvent
+//	watch <room-id>   poll a room and show every change
+//
+// Requests are sent to the HTTP/JSON gateway of the lobby service. The user
+// authenticates with the access token given with -token, or with -user if the
+// gateway trusts the user header set in http_user_header.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-lobby/client"
+	"github.com/opentarock/service-lobby/config"
+)
+
+var configFile = flag.String("config", "", "path to the lobby service JSON configuration file")
+var addr = flag.String("addr", "", "url of the HTTP gateway, overrides the address from the configuration")
+var token = flag.String("token", "", "access token of the user")
+var userId = flag.String("user", "", "user id sent in the user header the gateway trusts")
+var format = flag.String("format", "text", "output format, text or json")
+var interval = flag.Duration("interval", time.Second, "polling interval of the watch command")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [arguments]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  create <name>     create a room")
+	fmt.Fprintln(os.Stderr, "  join <room-id>    join a room")
+	fmt.Fprintln(os.Stderr, "  leave             leave the current room")
+	fmt.Fprintln(os.Stderr, "  list              list the rooms")
+	fmt.Fprintln(os.Stderr, "  info <room-id>    show a room")
+	fmt.Fprintln(os.Stderr, "  start             start the game in the current room")
+	fmt.Fprintln(os.Stderr, "  ready <state>     confirm being ready")
+	fmt.Fprintln(os.Stderr, "  watch <room-id>   poll a room and show every change")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	log.SetFlags(0)
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Unknown format: %s", *format)
+	}
+	command, args := flag.Arg(0), flag.Args()[1:]
+	request, err := newRequest(command, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gatewayUrl, err := gatewayUrl(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	header, err := authHeader(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lobbyClient := client.New(gatewayUrl, header)
+	send := func(request proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+		name, response := newResponse(request)
+		if err := lobbyClient.Request(name, request, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	if command == "watch" {
+		err = watch(send, request.(*proto_lobby.RoomInfoRequest), *interval)
+	} else {
+		var response proto.ProtobufMessage
+		response, err = send(request)
+		if err == nil {
+			err = printResponse(os.Stdout, response, *format)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newRequest returns the request sent by the command.
+func newRequest(command string, args []string) (proto.ProtobufMessage, error) {
+	var request proto.ProtobufMessage
+	var argNames []string
+	switch command {
+	case "create":
+		argNames = []string{"name"}
+		request = &proto_lobby.CreateRoomRequest{Name: argAt(args, 0)}
+	case "join":
+		argNames = []string{"room-id"}
+		request = &proto_lobby.JoinRoomRequest{RoomId: argAt(args, 0)}
+	case "leave":
+		request = &proto_lobby.LeaveRoomRequest{}
+	case "list":
+		request = &proto_lobby.ListRoomsRequest{}
+	case "info", "watch":
+		argNames = []string{"room-id"}
+		request = &proto_lobby.RoomInfoRequest{RoomId: argAt(args, 0)}
+	case "start":
+		request = &proto_lobby.StartGameRequest{}
+	case "ready":
+		argNames = []string{"state"}
+		request = &proto_lobby.PlayerReadyRequest{State: argAt(args, 0)}
+	default:
+		return nil, fmt.Errorf("Unknown command: %s", command)
+	}
+	if len(args) != len(argNames) {
+		return nil, fmt.Errorf("Usage: %s %s", command, strings.Join(argNames, " "))
+	}
+	return request, nil
+}
+
+func argAt(args []string, i int) *string {
+	if i < len(args) {
+		return pbuf.String(args[i])
+	}
+	return nil
+}
+
+func loadConfig() (*config.Config, error) {
+	if *configFile == "" {
+		return config.Default(), nil
+	}
+	return config.Load(*configFile)
+}
+
+// gatewayUrl returns the url of the HTTP gateway. Without -addr the address
+// the gateway binds is read from the configuration and a missing or wildcard
+// host is replaced with localhost.
+func gatewayUrl(conf *config.Config) (string, error) {
+	if *addr != "" {
+		return *addr, nil
+	}
+	if conf.HttpAddress == "" {
+		return "", errors.New("The HTTP gateway is disabled, set http_address or -addr")
+	}
+	host, port, err := net.SplitHostPort(conf.HttpAddress)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// authHeader returns the header authenticating the user given with -token
+// or -user.
+func authHeader(conf *config.Config) (http.Header, error) {
+	if *token != "" {
+		return client.BearerToken(*token), nil
+	}
+	if *userId == "" {
+		return nil, nil
+	}
+	if conf.HttpUserHeader == "" {
+		return nil, errors.New("-user requires http_user_header in the configuration, use -token instead")
+	}
+	return http.Header{http.CanonicalHeaderKey(conf.HttpUserHeader): {*userId}}, nil
+}
+
+// newResponse returns the name of the operation handling the request and
+// the response to decode its result into.
+func newResponse(request proto.ProtobufMessage) (string, proto.ProtobufMessage) {
+	switch request.(type) {
+	case *proto_lobby.CreateRoomRequest:
+		return "create_room", new(proto_lobby.CreateRoomResponse)
+	case *proto_lobby.JoinRoomRequest:
+		return "join_room", new(proto_lobby.JoinRoomResponse)
+	case *proto_lobby.LeaveRoomRequest:
+		return "leave_room", new(proto_lobby.LeaveRoomResponse)
+	case *proto_lobby.ListRoomsRequest:
+		return "list_rooms", new(proto_lobby.ListRoomsResponse)
+	case *proto_lobby.RoomInfoRequest:
+		return "room_info", new(proto_lobby.RoomInfoResponse)
+	case *proto_lobby.StartGameRequest:
+		return "start_game", new(proto_lobby.StartGameResponse)
+	case *proto_lobby.PlayerReadyRequest:
+		return "player_ready", new(proto_lobby.PlayerReadyResponse)
+	}
+	panic(fmt.Sprintf("No response for request type: %d", request.GetMessageType()))
+}
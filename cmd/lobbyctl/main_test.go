@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-lobby/config"
+)
+
+func TestGatewayUrl(t *testing.T) {
+	conf := config.Default()
+	_, err := gatewayUrl(conf)
+	assert.NotNil(t, err, "The gateway is disabled by default")
+
+	for httpAddress, expected := range map[string]string{
+		":8080":           "http://localhost:8080",
+		"0.0.0.0:8080":    "http://localhost:8080",
+		"lobby.test:8080": "http://lobby.test:8080",
+	} {
+		conf.HttpAddress = httpAddress
+		url, err := gatewayUrl(conf)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, url)
+	}
+}
+
+func TestAuthHeader(t *testing.T) {
+	conf := config.Default()
+	*userId = "1"
+	defer func() { *userId = "" }()
+	_, err := authHeader(conf)
+	assert.NotNil(t, err, "The user header is only sent if the gateway trusts it")
+
+	conf.HttpUserHeader = "x-user-id"
+	header, err := authHeader(conf)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", header.Get("X-User-Id"))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+)
+
+// printResponse writes the response in the given format, text or json.
+func printResponse(w io.Writer, response proto.ProtobufMessage, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	switch r := response.(type) {
+	case *proto_lobby.CreateRoomResponse:
+		if r.ErrorCode != nil {
+			return printError(w, r.GetErrorCode())
+		}
+		printRoom(w, r.GetRoom())
+	case *proto_lobby.JoinRoomResponse:
+		if r.ErrorCode != nil {
+			return printError(w, r.GetErrorCode())
+		}
+		printRoom(w, r.GetRoom())
+	case *proto_lobby.LeaveRoomResponse:
+		if r.ErrorCode != nil {
+			return printError(w, r.GetErrorCode())
+		}
+		fmt.Fprintln(w, "Left the room")
+	case *proto_lobby.ListRoomsResponse:
+		if len(r.GetRooms()) == 0 {
+			fmt.Fprintln(w, "No rooms")
+		}
+		for _, room := range r.GetRooms() {
+			fmt.Fprintf(w, "%s  %-20s  owner %s, %d players\n",
+				room.GetId(), room.GetName(), room.GetOwner(), 1+len(room.GetPlayers()))
+		}
+	case *proto_lobby.RoomInfoResponse:
+		if r.ErrorCode != nil {
+			return printError(w, r.GetErrorCode())
+		}
+		printRoom(w, r.GetRoom())
+	case *proto_lobby.StartGameResponse:
+		if r.ErrorCode != nil {
+			return printError(w, r.GetErrorCode())
+		}
+		fmt.Fprintln(w, "Game starting")
+	case *proto_lobby.PlayerReadyResponse:
+		if r.ErrorCode != nil {
+			return printError(w, r.GetErrorCode())
+		}
+		fmt.Fprintln(w, "Ready")
+	default:
+		return fmt.Errorf("Unknown response type: %d", response.GetMessageType())
+	}
+	return nil
+}
+
+// printError writes the error code of a response and returns it as an error
+// so the command exits with a failure.
+func printError(w io.Writer, code fmt.Stringer) error {
+	fmt.Fprintf(w, "Error: %s\n", code)
+	return fmt.Errorf("Request failed: %s", code)
+}
+
+func printRoom(w io.Writer, room *proto_lobby.Room) {
+	fmt.Fprintf(w, "Room %s\n", room.GetId())
+	fmt.Fprintf(w, "  name:    %s\n", room.GetName())
+	fmt.Fprintf(w, "  owner:   %s\n", room.GetOwner())
+	fmt.Fprintf(w, "  players: %s\n", strings.Join(room.GetPlayers(), ", "))
+	if room.Version != nil {
+		fmt.Fprintf(w, "  version: %d\n", room.GetVersion())
+	}
+	if options := room.GetOptions(); options != nil {
+		fmt.Fprintf(w, "  max players:  %d\n", options.GetMaxPlayers())
+		fmt.Fprintf(w, "  ready policy: %s\n", options.GetReadyPolicy())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+)
+
+func TestPrintRoomAsText(t *testing.T) {
+	var out bytes.Buffer
+	err := printResponse(&out, &proto_lobby.RoomInfoResponse{
+		Room: &proto_lobby.Room{
+			Id:      pbuf.String("id"),
+			Name:    pbuf.String("room"),
+			Owner:   pbuf.String("1"),
+			Players: []string{"2", "3"},
+		},
+	}, "text")
+	assert.Nil(t, err)
+	assert.Equal(t, "Room id\n  name:    room\n  owner:   1\n  players: 2, 3\n", out.String())
+}
+
+func TestPrintRoomVersion(t *testing.T) {
+	var out bytes.Buffer
+	printRoom(&out, &proto_lobby.Room{
+		Id:      pbuf.String("id"),
+		Name:    pbuf.String("room"),
+		Owner:   pbuf.String("1"),
+		Version: pbuf.Uint64(7),
+	})
+	assert.Equal(t, "Room id\n  name:    room\n  owner:   1\n  players: \n  version: 7\n", out.String())
+}
+
+func TestPrintErrorCode(t *testing.T) {
+	var out bytes.Buffer
+	err := printResponse(&out, &proto_lobby.JoinRoomResponse{
+		ErrorCode: proto_lobby.JoinRoomResponse_ROOM_FULL.Enum(),
+	}, "text")
+	assert.NotNil(t, err)
+	assert.Equal(t, "Error: ROOM_FULL\n", out.String())
+}
+
+func TestNewRequestChecksArguments(t *testing.T) {
+	request, err := newRequest("join", []string{"room-id"})
+	assert.Nil(t, err)
+	assert.Equal(t, "room-id", request.(*proto_lobby.JoinRoomRequest).GetRoomId())
+
+	_, err = newRequest("join", nil)
+	assert.NotNil(t, err)
+	_, err = newRequest("leave", []string{"extra"})
+	assert.NotNil(t, err)
+	_, err = newRequest("unknown", nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+)
+
+// watch polls the room every interval and prints the room whenever it
+// changes. It returns once the room no longer exists.
+func watch(
+	send func(request proto.ProtobufMessage) (proto.ProtobufMessage, error),
+	request *proto_lobby.RoomInfoRequest,
+	interval time.Duration) error {
+
+	var last []byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		response, err := send(request)
+		if err != nil {
+			return err
+		}
+		info := response.(*proto_lobby.RoomInfoResponse)
+		if info.ErrorCode != nil {
+			printResponse(os.Stdout, info, *format)
+			return nil
+		}
+		current, err := json.Marshal(info.GetRoom())
+		if err != nil {
+			return err
+		}
+		if string(current) != string(last) {
+			if *format == "text" {
+				fmt.Printf("%s\n", time.Now().Format("15:04:05.000"))
+			}
+			if err := printResponse(os.Stdout, info, *format); err != nil {
+				return err
+			}
+			last = current
+		}
+		<-ticker.C
+	}
+}
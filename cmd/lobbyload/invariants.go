@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+)
+
+// checkRooms returns a description of every invariant the rooms violate: a
+// user can only be in one room and a room can't hold more than maxPlayers.
+func checkRooms(rooms []*proto_lobby.Room, maxPlayers uint) []string {
+	// Rooms are checked in a fixed order so the same violation is described
+	// the same way every time.
+	sorted := append([]*proto_lobby.Room(nil), rooms...)
+	sort.Sort(byId(sorted))
+	var violations []string
+	userRoom := make(map[string]string)
+	for _, room := range sorted {
+		players := append([]string{room.GetOwner()}, room.GetPlayers()...)
+		if uint(len(players)) > maxPlayers {
+			violations = append(violations, fmt.Sprintf(
+				"room %s holds %d players, more than %d", room.GetId(), len(players), maxPlayers))
+		}
+		for _, userId := range players {
+			if other, ok := userRoom[userId]; ok {
+				violations = append(violations, fmt.Sprintf(
+					"user %s is in rooms %s and %s", userId, other, room.GetId()))
+				continue
+			}
+			userRoom[userId] = room.GetId()
+		}
+	}
+	return violations
+}
+
+// confirmedViolations checks the rooms twice and only returns the violations
+// found both times. The rooms are not read atomically so a player moving
+// between rooms can show up in both of them for a moment.
+func confirmedViolations(t target, maxPlayers uint) ([]string, error) {
+	rooms, err := t.Rooms()
+	if err != nil {
+		return nil, err
+	}
+	first := checkRooms(rooms, maxPlayers)
+	if len(first) == 0 {
+		return nil, nil
+	}
+	rooms, err = t.Rooms()
+	if err != nil {
+		return nil, err
+	}
+	again := make(map[string]bool)
+	for _, violation := range checkRooms(rooms, maxPlayers) {
+		again[violation] = true
+	}
+	var confirmed []string
+	for _, violation := range first {
+		if again[violation] {
+			confirmed = append(confirmed, violation)
+		}
+	}
+	return confirmed, nil
+}
+
+type byId []*proto_lobby.Room
+
+func (r byId) Len() int {
+	return len(r)
+}
+
+func (r byId) Less(i, j int) bool {
+	return r[i].GetId() < r[j].GetId()
+}
+
+func (r byId) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
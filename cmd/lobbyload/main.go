@@ -0,0 +1,165 @@
+// Command lobbyload simulates many virtual players against the lobby to find
+// out how much load it can handle.
+//
+// By default the players use an in-process RoomList, with -addr they send
+// their requests to the HTTP gateway of a running lobby service. The gateway
+// identifies the players by the header given with -user-header, it must be
+// configured to trust it with http_user_header. Every player creates, joins,
+// leaves, lists and starts rooms and confirms being ready in proportions
+// given by -mix. While the test runs the rooms are checked for invariant
+// violations, for example a user being in two rooms.
+//
+// Latency percentiles and error rates of every request are reported every
+// -report interval and at the end. The command exits with status 1 if any
+// invariant violations were found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// maxShownViolations is the number of invariant violations listed at the end.
+const maxShownViolations = 20
+
+var addr = flag.String("addr", "", "url of the HTTP gateway of the lobby service, if empty an in-process room list is used")
+var userHeader = flag.String("user-header", "X-User-Id", "header identifying the players, must match http_user_header of the service")
+var conns = flag.Int("conns", 16, "number of connections to the lobby service")
+var players = flag.Int("players", 1000, "number of virtual players")
+var duration = flag.Duration("duration", time.Minute, "duration of the test")
+var rampUp = flag.Duration("ramp", 5*time.Second, "time over which the players are started")
+var think = flag.Duration("think", 500*time.Millisecond, "average time between the actions of a player")
+var mixFlag = flag.String("mix", "", "weights of the player actions, for example create=1,join=4,list=3,leave=1,start=2,status=6")
+var maxPlayers = flag.Uint("max-players", 4, "maximum number of players in a room, must match the service configuration with -addr")
+var maxRooms = flag.Uint("max-rooms", 0, "maximum number of rooms of the in-process room list")
+var readyTimeout = flag.Duration("ready-timeout", 15*time.Second, "ready timeout of the in-process room list")
+var reportInterval = flag.Duration("report", 10*time.Second, "interval between progress reports")
+var checkInterval = flag.Duration("check", 5*time.Second, "interval between invariant checks")
+var seed = flag.Int64("seed", 0, "random seed, zero uses the current time")
+var verbose = flag.Bool("v", false, "show the log of the in-process room list")
+
+func main() {
+	flag.Parse()
+	log.SetFlags(log.Ltime)
+
+	playerMix, err := parseMix(defaultMix(), *mixFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	var t target
+	if *addr == "" {
+		limits := lobby.DefaultLimits()
+		limits.MaxPlayers = *maxPlayers
+		limits.MaxRooms = *maxRooms
+		limits.ReadyTimeout = *readyTimeout
+		t = newLocalTarget(limits)
+	} else {
+		t = newRemoteTarget(*addr, *userHeader, *conns, "lobbyload-checker")
+	}
+	defer t.Close()
+	// The log of the room list is written after the flags are handled so
+	// errors are still shown.
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	results := newStats()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	fmt.Printf("Starting %d players for %s (seed %d)\n", *players, *duration, *seed)
+	go func() {
+		for i := 0; i < *players; i++ {
+			p := &player{
+				id:     user.Id(fmt.Sprintf("load-%d", i)),
+				target: t,
+				stats:  results,
+				mix:    playerMix,
+				think:  *think,
+				rand:   rand.New(rand.NewSource(*seed + int64(i))),
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.run(stop)
+			}()
+			select {
+			case <-stop:
+				return
+			case <-time.After(*rampUp / time.Duration(*players)):
+			}
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	started := time.Now()
+	end := time.After(*duration)
+	report := time.NewTicker(*reportInterval)
+	defer report.Stop()
+	check := time.NewTicker(*checkInterval)
+	defer check.Stop()
+	violations := make(map[string]bool)
+	checkFailures := 0
+	checkInvariants := func() {
+		found, err := confirmedViolations(t, *maxPlayers)
+		if err != nil {
+			checkFailures++
+			return
+		}
+		for _, violation := range found {
+			violations[violation] = true
+		}
+	}
+loop:
+	for {
+		select {
+		case <-end:
+			break loop
+		case <-interrupt:
+			break loop
+		case <-report.C:
+			fmt.Printf("\n%s elapsed, %d invariant violations\n", time.Since(started).Round(time.Second), len(violations))
+			results.report(os.Stdout, time.Since(started))
+		case <-check.C:
+			checkInvariants()
+		}
+	}
+	close(stop)
+	wg.Wait()
+	elapsed := time.Since(started)
+	checkInvariants()
+
+	fmt.Printf("\nFinished after %s\n", elapsed.Round(time.Second))
+	results.report(os.Stdout, elapsed)
+	if checkFailures > 0 {
+		fmt.Printf("\n%d invariant checks failed to list the rooms\n", checkFailures)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("\n%d invariant violations:\n", len(violations))
+		shown := 0
+		for violation := range violations {
+			if shown == maxShownViolations {
+				fmt.Printf("  ...\n")
+				break
+			}
+			fmt.Printf("  %s\n", violation)
+			shown++
+		}
+		os.Exit(1)
+	}
+	fmt.Println("\nNo invariant violations")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+)
+
+// mix are the relative weights of the actions of the virtual players.
+// Players outside of a room choose between create, join and list, players in
+// a room between leave, start and status.
+type mix struct {
+	Create uint
+	Join   uint
+	List   uint
+	Leave  uint
+	Start  uint
+	Status uint
+}
+
+func defaultMix() mix {
+	return mix{Create: 1, Join: 4, List: 3, Leave: 1, Start: 2, Status: 6}
+}
+
+// parseMix overrides the weights in m with a list like "create=1,join=4".
+func parseMix(m mix, s string) (mix, error) {
+	weights := map[string]*uint{
+		"create": &m.Create,
+		"join":   &m.Join,
+		"list":   &m.List,
+		"leave":  &m.Leave,
+		"start":  &m.Start,
+		"status": &m.Status,
+	}
+	for _, entry := range strings.Split(s, ",") {
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		weight, ok := weights[parts[0]]
+		if !ok || len(parts) != 2 {
+			return m, fmt.Errorf("Invalid mix entry: %s", entry)
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return m, fmt.Errorf("Invalid mix weight: %s", entry)
+		}
+		*weight = uint(value)
+	}
+	return m, nil
+}
+
+// player is a virtual player. Each player runs in its own goroutine and only
+// remembers what the lobby told it.
+type player struct {
+	id     user.Id
+	target target
+	stats  *stats
+	mix    mix
+	think  time.Duration
+	rand   *rand.Rand
+	// roomId is the room the player believes to be in.
+	roomId string
+	owner  bool
+	// canStart is true if the player owns a room with other players that
+	// has not started the game as far as the player knows.
+	canStart bool
+	// rooms are the rooms from the last list request.
+	rooms []*proto_lobby.Room
+}
+
+// run performs actions until stop is closed. Between actions the player
+// waits for a random think time averaging p.think.
+func (p *player) run(stop <-chan struct{}) {
+	for {
+		wait := time.Duration(p.rand.ExpFloat64() * float64(p.think))
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		if p.roomId == "" {
+			p.outsideRoom()
+		} else {
+			p.inRoom()
+		}
+	}
+}
+
+func (p *player) outsideRoom() {
+	switch p.choose(p.mix.Create, p.mix.Join, p.mix.List) {
+	case 0:
+		response, ok := p.do("create_room", &proto_lobby.CreateRoomRequest{
+			Name: pbuf.String("load-" + p.id.String()),
+		})
+		if ok && response.(*proto_lobby.CreateRoomResponse).ErrorCode == nil {
+			p.enter(response.(*proto_lobby.CreateRoomResponse).GetRoom())
+		}
+	case 1:
+		if len(p.rooms) == 0 {
+			p.list()
+			return
+		}
+		room := p.rooms[p.rand.Intn(len(p.rooms))]
+		response, ok := p.do("join_room", &proto_lobby.JoinRoomRequest{RoomId: room.Id})
+		if ok && response.(*proto_lobby.JoinRoomResponse).ErrorCode == nil {
+			p.enter(response.(*proto_lobby.JoinRoomResponse).GetRoom())
+		} else {
+			p.rooms = nil
+		}
+	case 2:
+		p.list()
+	}
+}
+
+func (p *player) inRoom() {
+	start := p.mix.Start
+	if !p.canStart {
+		start = 0
+	}
+	switch p.choose(p.mix.Leave, start, p.mix.Status) {
+	case 0:
+		response, ok := p.do("leave_room", &proto_lobby.LeaveRoomRequest{})
+		if ok && response.(*proto_lobby.LeaveRoomResponse).ErrorCode == nil {
+			p.roomId = ""
+		}
+	case 1:
+		p.do("start_game", &proto_lobby.StartGameRequest{})
+		p.canStart = false
+	case 2:
+		p.status()
+	}
+}
+
+// status asks for the state of the player's room and confirms being ready
+// if the game is starting.
+func (p *player) status() {
+	response, ok := p.do("get_my_room", &proto_lobby.GetMyRoomRequest{})
+	if !ok {
+		return
+	}
+	status := response.(*proto_lobby.GetMyRoomResponse)
+	if status.ErrorCode != nil {
+		p.roomId = ""
+		return
+	}
+	p.enter(status.GetRoom())
+	p.canStart = p.canStart && status.GetStatus() == proto_lobby.GetMyRoomResponse_NOT_STARTED
+	if status.GetStatus() == proto_lobby.GetMyRoomResponse_STARTING && !status.GetReady() {
+		p.do("player_ready", &proto_lobby.PlayerReadyRequest{State: status.ReadyState})
+	}
+}
+
+func (p *player) list() {
+	response, ok := p.do("list_rooms", &proto_lobby.ListRoomsRequest{})
+	if ok {
+		p.rooms = response.(*proto_lobby.ListRoomsResponse).GetRooms()
+	}
+}
+
+func (p *player) enter(room *proto_lobby.Room) {
+	p.roomId = room.GetId()
+	p.owner = room.GetOwner() == p.id.String()
+	p.canStart = p.owner && len(room.GetPlayers()) > 0
+}
+
+// do sends the request and records the result. False is returned if the
+// request could not be made.
+func (p *player) do(op string, request proto.ProtobufMessage) (proto.ProtobufMessage, bool) {
+	start := time.Now()
+	response, err := p.target.Do(p.id, request)
+	code := ""
+	if err == nil {
+		code = errorCode(response)
+	}
+	p.stats.record(op, time.Since(start), code, err)
+	return response, err == nil
+}
+
+// choose returns the index of a weight chosen at random in proportion to the
+// weights, or -1 if all of them are zero.
+func (p *player) choose(weights ...uint) int {
+	var total uint
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return -1
+	}
+	n := uint(p.rand.Int63n(int64(total)))
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return -1
+}
+
+// errorCode returns the name of the error code of the response or an empty
+// string if there is none.
+func errorCode(response proto.ProtobufMessage) string {
+	var code fmt.Stringer
+	switch r := response.(type) {
+	case *proto_lobby.CreateRoomResponse:
+		if r.ErrorCode != nil {
+			code = r.GetErrorCode()
+		}
+	case *proto_lobby.JoinRoomResponse:
+		if r.ErrorCode != nil {
+			code = r.GetErrorCode()
+		}
+	case *proto_lobby.LeaveRoomResponse:
+		if r.ErrorCode != nil {
+			code = r.GetErrorCode()
+		}
+	case *proto_lobby.StartGameResponse:
+		if r.ErrorCode != nil {
+			code = r.GetErrorCode()
+		}
+	case *proto_lobby.PlayerReadyResponse:
+		if r.ErrorCode != nil {
+			code = r.GetErrorCode()
+		}
+	case *proto_lobby.GetMyRoomResponse:
+		if r.ErrorCode != nil {
+			code = r.GetErrorCode()
+		}
+	}
+	if code == nil {
+		return ""
+	}
+	return code.String()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogramGrowth is the ratio between the bounds of consecutive histogram
+// buckets, it bounds the error of the reported percentiles to 5%.
+const histogramGrowth = 1.05
+
+// histogramBuckets covers latencies from a microsecond to over an hour.
+const histogramBuckets = 500
+
+// histogram records latencies in buckets growing exponentially so it uses
+// the same memory no matter how long the test runs.
+type histogram struct {
+	counts [histogramBuckets]uint64
+	total  uint64
+	max    time.Duration
+}
+
+func bucketOf(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(us) / math.Log(histogramGrowth)))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+// upperBound returns the largest latency recorded in bucket i.
+func upperBound(i int) time.Duration {
+	return time.Duration(math.Pow(histogramGrowth, float64(i)) * float64(time.Microsecond))
+}
+
+func (h *histogram) record(d time.Duration) {
+	h.counts[bucketOf(d)]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// percentile returns the latency below which p percent of the recorded
+// latencies fall.
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	var seen uint64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			if bound := upperBound(i); bound < h.max {
+				return bound
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// opStats are the results of one kind of request.
+type opStats struct {
+	latency histogram
+	// codes counts the responses by error code.
+	codes map[string]uint64
+	// failures counts the requests that could not be made by error.
+	failures map[string]uint64
+}
+
+// stats collects the results of all the requests.
+type stats struct {
+	ops  map[string]*opStats
+	lock *sync.Mutex
+}
+
+func newStats() *stats {
+	return &stats{
+		ops:  make(map[string]*opStats),
+		lock: new(sync.Mutex),
+	}
+}
+
+// record records the result of a request. An empty code means the request
+// succeeded.
+func (s *stats) record(op string, latency time.Duration, code string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	o, ok := s.ops[op]
+	if !ok {
+		o = &opStats{
+			codes:    make(map[string]uint64),
+			failures: make(map[string]uint64),
+		}
+		s.ops[op] = o
+	}
+	o.latency.record(latency)
+	if err != nil {
+		o.failures[err.Error()]++
+	} else if code != "" {
+		o.codes[code]++
+	}
+}
+
+// report writes a table with the latency percentiles and the error rates of
+// every kind of request.
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, 0, len(s.ops))
+	for name := range s.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "%-14s %9s %9s %9s %9s %9s %9s %8s %8s\n",
+		"request", "count", "req/s", "p50", "p90", "p99", "max", "errors", "failed")
+	for _, name := range names {
+		o := s.ops[name]
+		errors, failures := sum(o.codes), sum(o.failures)
+		total := o.latency.total
+		fmt.Fprintf(w, "%-14s %9d %9.1f %9s %9s %9s %9s %7.2f%% %7.2f%%\n",
+			name, total, float64(total)/elapsed.Seconds(),
+			round(o.latency.percentile(50)), round(o.latency.percentile(90)),
+			round(o.latency.percentile(99)), round(o.latency.max),
+			percent(errors, total), percent(failures, total))
+		printCounts(w, o.codes)
+		printCounts(w, o.failures)
+	}
+}
+
+func sum(counts map[string]uint64) uint64 {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
+
+// printCounts writes the counts sorted by name.
+func printCounts(w io.Writer, counts map[string]uint64) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-30s %9d\n", name, counts[name])
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
+
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	assert.InEpsilon(t, float64(50*time.Millisecond), float64(h.percentile(50)), 0.05)
+	assert.InEpsilon(t, float64(99*time.Millisecond), float64(h.percentile(99)), 0.05)
+	assert.Equal(t, 100*time.Millisecond, h.percentile(100))
+}
+
+func TestParseMix(t *testing.T) {
+	m, err := parseMix(defaultMix(), "create=5,status=0")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(5), m.Create)
+	assert.Equal(t, uint(0), m.Status)
+	assert.Equal(t, defaultMix().Join, m.Join)
+
+	_, err = parseMix(defaultMix(), "dance=1")
+	assert.NotNil(t, err)
+}
+
+func TestCheckRooms(t *testing.T) {
+	rooms := []*proto_lobby.Room{
+		{Id: pbuf.String("a"), Owner: pbuf.String("1"), Players: []string{"2", "3"}},
+		{Id: pbuf.String("b"), Owner: pbuf.String("4"), Players: []string{"2"}},
+	}
+	assert.Equal(t, []string{"user 2 is in rooms a and b"}, checkRooms(rooms, 3))
+	assert.Equal(t, 2, len(checkRooms(rooms, 2)))
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/client"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// target is the lobby the virtual players send their requests to.
+type target interface {
+	// Do sends the request as the user and returns the response. An error is
+	// returned if the request could not be made, error codes are part of the
+	// response.
+	Do(userId user.Id, request proto.ProtobufMessage) (proto.ProtobufMessage, error)
+	// Rooms returns all the rooms for checking the invariants.
+	Rooms() ([]*proto_lobby.Room, error)
+	Close() error
+}
+
+// localTarget runs the requests directly on an in-process RoomList.
+type localTarget struct {
+	roomList *lobby.RoomList
+}
+
+func newLocalTarget(limits lobby.Limits) *localTarget {
+	roomList := lobby.NewRoomList(nil)
+	roomList.SetLimits(limits)
+	return &localTarget{roomList: roomList}
+}
+
+// Do recovers from panics in the room list and reports them as failed
+// requests so a bug does not end the test.
+func (t *localTarget) Do(userId user.Id, request proto.ProtobufMessage) (response proto.ProtobufMessage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			response, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	switch r := request.(type) {
+	case *proto_lobby.CreateRoomRequest:
+		room, errCode := t.roomList.CreateRoom(userId, r.GetName(), r.GetOptions())
+		response := &proto_lobby.CreateRoomResponse{Room: room}
+		if room == nil {
+			response.ErrorCode = errCode.Enum()
+		}
+		return response, nil
+	case *proto_lobby.JoinRoomRequest:
+		room, errCode := t.roomList.JoinRoom(userId, lobby.RoomId(r.GetRoomId()))
+		response := &proto_lobby.JoinRoomResponse{Room: room}
+		if room == nil {
+			response.ErrorCode = errCode.Enum()
+		}
+		return response, nil
+	case *proto_lobby.LeaveRoomRequest:
+		response := &proto_lobby.LeaveRoomResponse{}
+		if ok, errCode := t.roomList.LeaveRoom(userId); !ok {
+			response.ErrorCode = errCode.Enum()
+		}
+		return response, nil
+	case *proto_lobby.ListRoomsRequest:
+		return &proto_lobby.ListRoomsResponse{
+			Rooms: t.roomList.ListRoomsExcluding(userId),
+		}, nil
+	case *proto_lobby.StartGameRequest:
+		response := &proto_lobby.StartGameResponse{}
+		switch err := t.roomList.StartGame(userId, lobby.OwnRoom, r.GetExpectedVersion()); err {
+		case nil:
+		case lobby.ErrNotInRoom:
+			response.ErrorCode = proto_lobby.StartGameResponse_NOT_IN_ROOM.Enum()
+		case lobby.ErrNotOwner:
+			response.ErrorCode = proto_lobby.StartGameResponse_NOT_OWNER.Enum()
+		case lobby.ErrAlreadyStarted:
+			response.ErrorCode = proto_lobby.StartGameResponse_ALREADY_STARTED.Enum()
+		case lobby.ErrVersionConflict:
+			response.ErrorCode = proto_lobby.StartGameResponse_VERSION_CONFLICT.Enum()
+		default:
+			return nil, err
+		}
+		return response, nil
+	case *proto_lobby.PlayerReadyRequest:
+		response := &proto_lobby.PlayerReadyResponse{}
+		switch err := t.roomList.PlayerReady(userId, r.GetState()); err {
+		case nil:
+		case lobby.ErrNotInRoom:
+			response.ErrorCode = proto_lobby.PlayerReadyResponse_NOT_IN_ROOM.Enum()
+		case lobby.ErrUnexpectedReady:
+			response.ErrorCode = proto_lobby.PlayerReadyResponse_UNEXPECTED.Enum()
+		case lobby.ErrInvalidStateString:
+			response.ErrorCode = proto_lobby.PlayerReadyResponse_INVALID_STATE.Enum()
+		default:
+			return nil, err
+		}
+		return response, nil
+	case *proto_lobby.GetMyRoomRequest:
+		status, err := t.roomList.GetMyRoom(userId)
+		if err == lobby.ErrNotInRoom {
+			return &proto_lobby.GetMyRoomResponse{
+				ErrorCode: proto_lobby.GetMyRoomResponse_NOT_IN_ROOM.Enum(),
+			}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		response := &proto_lobby.GetMyRoomResponse{
+			Room:   status.Room,
+			Status: proto_lobby.GetMyRoomResponse_NOT_STARTED.Enum(),
+		}
+		if status.Starting {
+			response.Status = proto_lobby.GetMyRoomResponse_STARTING.Enum()
+			response.ReadyState = pbuf.String(status.State)
+			response.Ready = pbuf.Bool(status.Ready)
+		} else if status.InProgress {
+			response.Status = proto_lobby.GetMyRoomResponse_IN_PROGRESS.Enum()
+		}
+		return response, nil
+	}
+	return nil, fmt.Errorf("Unsupported request type: %d", request.GetMessageType())
+}
+
+func (t *localTarget) Rooms() ([]*proto_lobby.Room, error) {
+	states := t.roomList.RoomStates()
+	rooms := make([]*proto_lobby.Room, 0, len(states))
+	for _, state := range states {
+		rooms = append(rooms, state.Room)
+	}
+	return rooms, nil
+}
+
+func (t *localTarget) Close() error {
+	return nil
+}
+
+// remoteTarget sends the requests to the HTTP gateway of a running lobby
+// service. The virtual players are identified by the user header so the
+// gateway must trust it, which is only safe on a test deployment.
+type remoteTarget struct {
+	url        string
+	userHeader string
+	httpClient *http.Client
+	// checkerId is the user listing the rooms for the invariant checks, it
+	// must never join a room so the list includes all the rooms.
+	checkerId user.Id
+}
+
+// newRemoteTarget returns a target sending requests to the gateway at url
+// over at most conns connections.
+func newRemoteTarget(url, userHeader string, conns int, checkerId user.Id) *remoteTarget {
+	return &remoteTarget{
+		url:        url,
+		userHeader: http.CanonicalHeaderKey(userHeader),
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				MaxConnsPerHost:     conns,
+				MaxIdleConnsPerHost: conns,
+			},
+		},
+		checkerId: checkerId,
+	}
+}
+
+func (t *remoteTarget) Do(userId user.Id, request proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+	c := client.Client{
+		Url:        t.url,
+		Header:     http.Header{t.userHeader: {userId.String()}},
+		HttpClient: t.httpClient,
+	}
+	name, response := newResponse(request)
+	if err := c.Request(name, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (t *remoteTarget) Rooms() ([]*proto_lobby.Room, error) {
+	response, err := t.Do(t.checkerId, &proto_lobby.ListRoomsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return response.(*proto_lobby.ListRoomsResponse).GetRooms(), nil
+}
+
+func (t *remoteTarget) Close() error {
+	t.httpClient.Transport.(*http.Transport).CloseIdleConnections()
+	return nil
+}
+
+// newResponse returns the name of the operation handling the request and
+// the response to decode its result into.
+func newResponse(request proto.ProtobufMessage) (string, proto.ProtobufMessage) {
+	switch request.(type) {
+	case *proto_lobby.CreateRoomRequest:
+		return "create_room", new(proto_lobby.CreateRoomResponse)
+	case *proto_lobby.JoinRoomRequest:
+		return "join_room", new(proto_lobby.JoinRoomResponse)
+	case *proto_lobby.LeaveRoomRequest:
+		return "leave_room", new(proto_lobby.LeaveRoomResponse)
+	case *proto_lobby.ListRoomsRequest:
+		return "list_rooms", new(proto_lobby.ListRoomsResponse)
+	case *proto_lobby.StartGameRequest:
+		return "start_game", new(proto_lobby.StartGameResponse)
+	case *proto_lobby.PlayerReadyRequest:
+		return "player_ready", new(proto_lobby.PlayerReadyResponse)
+	case *proto_lobby.GetMyRoomRequest:
+		return "get_my_room", new(proto_lobby.GetMyRoomResponse)
+	}
+	panic(fmt.Sprintf("No response for request type: %d", request.GetMessageType()))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/service"
+)
+
+func TestLocalLoadKeepsInvariants(t *testing.T) {
+	limits := lobby.DefaultLimits()
+	limits.MaxPlayers = 3
+	limits.ReadyTimeout = 50 * time.Millisecond
+	target := newLocalTarget(limits)
+	defer target.Close()
+	results := newStats()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		p := &player{
+			id:     user.Id(fmt.Sprintf("load-%d", i)),
+			target: target,
+			stats:  results,
+			mix:    defaultMix(),
+			think:  time.Millisecond,
+			rand:   rand.New(rand.NewSource(int64(i))),
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.run(stop)
+		}()
+	}
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	for op, o := range results.ops {
+		assert.Empty(t, o.failures, "Failed %s requests", op)
+	}
+	assert.NoError(t, target.roomList.CheckInvariants())
+	violations, err := confirmedViolations(target, limits.MaxPlayers)
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestRemoteTargetSendsRequestsAsThePlayers(t *testing.T) {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	server := httptest.NewServer(service.NewHttpHandler(handlers, service.HeaderAuthenticator{Header: "X-Load-User"}))
+	defer server.Close()
+	target := newRemoteTarget(server.URL, "x-load-user", 2, "checker")
+	defer target.Close()
+
+	response, err := target.Do("1", &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "1", response.(*proto_lobby.CreateRoomResponse).GetRoom().GetOwner())
+	response, err = target.Do("2", &proto_lobby.StartGameRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, proto_lobby.StartGameResponse_NOT_IN_ROOM, response.(*proto_lobby.StartGameResponse).GetErrorCode())
+	rooms, err := target.Rooms()
+	assert.NoError(t, err)
+	assert.Len(t, rooms, 1)
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+)
+
+// Config holds all the lobby service settings.
+// Settings tagged with live:"true" are applied to a running service when the
+// configuration is reloaded, the rest only take effect after a restart.
+type Config struct {
+	ServiceAddress string `json:"service_address"`
+	NotifyAddress  string `json:"notify_address"`
+	// HttpAddress is the address of the HTTP/JSON gateway, if empty the
+	// gateway is disabled.
+	HttpAddress string `json:"http_address"`
+	// WebsocketAddress is the address of the WebSocket gateway, if empty the
+	// gateway is disabled.
+	WebsocketAddress string `json:"websocket_address"`
+	// WebsocketOrigins are the origins of the web pages allowed to connect to
+	// the WebSocket gateway, if empty only pages served from the gateway's
+	// own host are.
+	WebsocketOrigins []string `json:"websocket_origins"`
+	// GrpcAddress is the address of the gRPC server, if empty the server is
+	// disabled.
+	GrpcAddress string `json:"grpc_address"`
+	// AccessTokens is a file with a bearer token and the id of the user it
+	// belongs to on every line. Users of the gateways authenticate with these
+	// tokens unless HttpUserHeader is set, users of the WebSocket gateway
+	// always do.
+	AccessTokens string `json:"access_tokens"`
+	// HttpUserHeader is the request header containing the authenticated
+	// user id, set by a proxy in front of the gateways. Anyone can send the
+	// header so it must only be set if the gateways can't be reached except
+	// through the proxy. If empty, the default, users authenticate with
+	// AccessTokens instead.
+	HttpUserHeader string `json:"http_user_header"`
+	// AuditLog is the file admin actions are appended to, if empty they are
+	// written to the standard error.
+	AuditLog     string   `json:"audit_log"`
+	MaxRooms     uint     `json:"max_rooms" live:"true"`
+	MaxPlayers   uint     `json:"max_players" live:"true"`
+	ReadyTimeout Duration `json:"ready_timeout" live:"true"`
+	// RoomIdleTtl is how long a room that is not playing a game can go
+	// without activity before it is closed, zero disables it.
+	RoomIdleTtl Duration `json:"room_idle_ttl" live:"true"`
+	// GameIdleTtl is the idle ttl of rooms with a game in progress, zero
+	// disables it.
+	GameIdleTtl Duration `json:"game_idle_ttl" live:"true"`
+	// IdleWarning is how long before an idle room is closed its players are
+	// warned about it.
+	IdleWarning Duration `json:"idle_warning" live:"true"`
+	// HeartbeatTimeout is how long after the last heartbeat request a player
+	// is considered disconnected.
+	HeartbeatTimeout Duration `json:"heartbeat_timeout" live:"true"`
+	// DisconnectGrace is how long a disconnected player keeps their seat.
+	DisconnectGrace Duration `json:"disconnect_grace" live:"true"`
+	// MaxRoomNameLength is the maximum number of characters in a room name.
+	MaxRoomNameLength uint `json:"max_room_name_length" live:"true"`
+	// MaxChatMessageLength is the maximum number of characters in a chat
+	// message.
+	MaxChatMessageLength uint `json:"max_chat_message_length" live:"true"`
+	// ChatHistory is the number of chat messages every room keeps for
+	// players that join later.
+	ChatHistory uint `json:"chat_history" live:"true"`
+	// VoteTimeout is how long the members of a room have to decide a vote.
+	VoteTimeout Duration `json:"vote_timeout" live:"true"`
+	// VoteThreshold is the percentage of the voters in a room that must vote
+	// yes for a vote to pass.
+	VoteThreshold uint `json:"vote_threshold" live:"true"`
+	// KickCooldown is how long a player kicked from a room by vote can't
+	// join it again, zero lets them join right away.
+	KickCooldown Duration `json:"kick_cooldown" live:"true"`
+	// WordList is a file with one word per line, room names and chat
+	// messages containing any of the words are not allowed. If empty no
+	// words are blocked.
+	WordList string `json:"word_list"`
+	// DefaultRateLimit is the per user limit of requests that have no entry
+	// in RateLimits.
+	DefaultRateLimit RateLimit `json:"default_rate_limit" live:"true"`
+	// RateLimits are the per user limits by request name, for example
+	// create_room or list_rooms.
+	RateLimits map[string]RateLimit `json:"rate_limits" live:"true"`
+	// MaxConcurrentRequests is the maximum number of requests handled at the
+	// same time, zero means there is no limit.
+	MaxConcurrentRequests uint `json:"max_concurrent_requests" live:"true"`
+	// IdempotencyTtl is how long the response to a request with an
+	// idempotency key is returned to retries of the request, zero disables
+	// it.
+	IdempotencyTtl Duration `json:"idempotency_ttl" live:"true"`
+	// MaxIdempotentResponses is the number of responses kept for retries
+	// per user.
+	MaxIdempotentResponses uint `json:"max_idempotent_responses" live:"true"`
+	// Roles assigns roles like "admin", "moderator" or "banned" to users,
+	// users without an entry have the role "user".
+	Roles map[user.Id]authz.Role `json:"roles" live:"true"`
+}
+
+// RateLimit allows Rate requests per second on average with bursts of up to
+// Burst requests. A zero Rate means there is no limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst uint    `json:"burst"`
+}
+
+// Default returns the configuration used when no configuration file is given.
+func Default() *Config {
+	return &Config{
+		ServiceAddress:   "tcp://*:7001",
+		NotifyAddress:    "tcp://localhost:8001",
+		HttpAddress:      "",
+		WebsocketAddress: "",
+		GrpcAddress:      "",
+		MaxRooms:         0,
+		MaxPlayers:       4,
+		ReadyTimeout:     Duration(15 * time.Second),
+		RoomIdleTtl:      Duration(10 * time.Minute),
+		GameIdleTtl:      Duration(2 * time.Hour),
+		IdleWarning:      Duration(time.Minute),
+		HeartbeatTimeout: Duration(30 * time.Second),
+		DisconnectGrace:  Duration(time.Minute),
+		DefaultRateLimit: RateLimit{Rate: 20, Burst: 40},
+		RateLimits: map[string]RateLimit{
+			"create_room":       {Rate: 1, Burst: 5},
+			"join_room":         {Rate: 2, Burst: 10},
+			"leave_room":        {Rate: 2, Burst: 10},
+			"list_rooms":        {Rate: 2, Burst: 10},
+			"send_room_message": {Rate: 1, Burst: 5},
+			"start_vote":        {Rate: 0.2, Burst: 2},
+		},
+		MaxConcurrentRequests:  256,
+		IdempotencyTtl:         Duration(2 * time.Minute),
+		MaxIdempotentResponses: 16,
+		MaxRoomNameLength:      32,
+		MaxChatMessageLength:   500,
+		ChatHistory:            50,
+		VoteTimeout:            Duration(30 * time.Second),
+		VoteThreshold:          60,
+		KickCooldown:           Duration(5 * time.Minute),
+	}
+}
+
+// Load reads a JSON configuration file. Settings missing from the file keep
+// their default values.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := Default()
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("Error parsing config file %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Validate checks that all the settings have sensible values.
+func (c *Config) Validate() error {
+	if c.ServiceAddress == "" {
+		return errors.New("service_address must not be empty")
+	}
+	if c.NotifyAddress == "" {
+		return errors.New("notify_address must not be empty")
+	}
+	gatewayEnabled := c.HttpAddress != "" || c.WebsocketAddress != "" || c.GrpcAddress != ""
+	if gatewayEnabled && c.HttpUserHeader == "" && c.AccessTokens == "" {
+		return errors.New("access_tokens or http_user_header must be set if a gateway is enabled")
+	}
+	if c.WebsocketAddress != "" && c.AccessTokens == "" {
+		return errors.New("access_tokens must be set if the WebSocket gateway is enabled")
+	}
+	if c.MaxPlayers < 1 {
+		return errors.New("max_players must be at least 1")
+	}
+	if c.MaxRoomNameLength < 1 {
+		return errors.New("max_room_name_length must be at least 1")
+	}
+	if c.MaxChatMessageLength < 1 {
+		return errors.New("max_chat_message_length must be at least 1")
+	}
+	if c.VoteThreshold < 1 || c.VoteThreshold > 100 {
+		return errors.New("vote_threshold must be between 1 and 100")
+	}
+	if c.VoteTimeout <= 0 {
+		return errors.New("vote_timeout must be positive")
+	}
+	if c.KickCooldown < 0 {
+		return errors.New("kick_cooldown must not be negative")
+	}
+	if c.ReadyTimeout <= 0 {
+		return errors.New("ready_timeout must be positive")
+	}
+	if c.RoomIdleTtl < 0 || c.GameIdleTtl < 0 || c.IdleWarning < 0 {
+		return errors.New("room_idle_ttl, game_idle_ttl and idle_warning must not be negative")
+	}
+	if c.HeartbeatTimeout <= 0 {
+		return errors.New("heartbeat_timeout must be positive")
+	}
+	if c.DisconnectGrace < 0 {
+		return errors.New("disconnect_grace must not be negative")
+	}
+	if c.IdempotencyTtl < 0 {
+		return errors.New("idempotency_ttl must not be negative")
+	}
+	if err := c.DefaultRateLimit.validate(); err != nil {
+		return fmt.Errorf("default_rate_limit: %s", err)
+	}
+	for name, limit := range c.RateLimits {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("rate_limits.%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (l RateLimit) validate() error {
+	if l.Rate < 0 {
+		return errors.New("rate must not be negative")
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return errors.New("burst must be at least 1")
+	}
+	return nil
+}
+
+// Duration is a time.Duration that is encoded in JSON as a string
+// like "15s" or "1m30s".
+type Duration time.Duration
+
+// Get returns the value as time.Duration.
+func (d Duration) Get() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("Duration must be a string: %s", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,199 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-lobby/config"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "lobby-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(data)
+	return f.Name()
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	assert.Nil(t, config.Default().Validate())
+}
+
+func TestMissingSettingsKeepDefaultValues(t *testing.T) {
+	path := writeConfig(t, `{"max_players": 8, "ready_timeout": "30s"}`)
+	defer os.Remove(path)
+
+	c, err := config.Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, c.MaxPlayers)
+	assert.Equal(t, 30*time.Second, c.ReadyTimeout.Get())
+	assert.Equal(t, config.Default().ServiceAddress, c.ServiceAddress)
+}
+
+func TestInvalidDurationIsRejected(t *testing.T) {
+	path := writeConfig(t, `{"ready_timeout": "soon"}`)
+	defer os.Remove(path)
+
+	_, err := config.Load(path)
+	assert.NotNil(t, err)
+}
+
+func TestInvalidConfigIsNotLoaded(t *testing.T) {
+	path := writeConfig(t, `{"max_players": 0}`)
+	defer os.Remove(path)
+
+	_, err := config.NewManager(path)
+	assert.NotNil(t, err)
+}
+
+func TestNegativeIdleTtlIsRejected(t *testing.T) {
+	path := writeConfig(t, `{"room_idle_ttl": "-1m"}`)
+	defer os.Remove(path)
+
+	_, err := config.NewManager(path)
+	assert.NotNil(t, err)
+}
+
+func TestNegativeIdempotencyTtlIsRejected(t *testing.T) {
+	path := writeConfig(t, `{"idempotency_ttl": "-1m"}`)
+	defer os.Remove(path)
+
+	_, err := config.NewManager(path)
+	assert.NotNil(t, err)
+}
+
+func TestGatewayRequiresAuthentication(t *testing.T) {
+	c := config.Default()
+	c.HttpAddress = ":8080"
+	assert.NotNil(t, c.Validate(), "Gateways don't trust a header unless configured to")
+	c.AccessTokens = "tokens"
+	assert.Nil(t, c.Validate())
+	c.AccessTokens = ""
+	c.HttpUserHeader = "X-User-Id"
+	assert.Nil(t, c.Validate())
+}
+
+func TestWebsocketGatewayRequiresAccessTokens(t *testing.T) {
+	c := config.Default()
+	c.WebsocketAddress = ":8081"
+	c.HttpUserHeader = "X-User-Id"
+	assert.NotNil(t, c.Validate(), "Browsers can't send the user header")
+	c.AccessTokens = "tokens"
+	assert.Nil(t, c.Validate())
+}
+
+func TestVoteThresholdOver100IsRejected(t *testing.T) {
+	path := writeConfig(t, `{"vote_threshold": 101}`)
+	defer os.Remove(path)
+
+	_, err := config.NewManager(path)
+	assert.NotNil(t, err)
+}
+
+func TestRateLimitsAreMergedWithDefaults(t *testing.T) {
+	path := writeConfig(t, `{"rate_limits": {"join_room": {"rate": 5, "burst": 20}}}`)
+	defer os.Remove(path)
+
+	c, err := config.Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, config.RateLimit{Rate: 5, Burst: 20}, c.RateLimits["join_room"])
+	assert.Equal(t, config.Default().RateLimits["create_room"], c.RateLimits["create_room"])
+}
+
+func TestRateLimitWithoutBurstIsRejected(t *testing.T) {
+	path := writeConfig(t, `{"rate_limits": {"join_room": {"rate": 5}}}`)
+	defer os.Remove(path)
+
+	_, err := config.NewManager(path)
+	assert.NotNil(t, err)
+}
+
+func TestUnknownRoleIsRejected(t *testing.T) {
+	path := writeConfig(t, `{"roles": {"1": "admin", "2": "superuser"}}`)
+	defer os.Remove(path)
+
+	_, err := config.Load(path)
+	assert.NotNil(t, err)
+}
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	path := writeConfig(t, `{"max_players": 4}`)
+	defer os.Remove(path)
+	m, err := config.NewManager(path)
+	assert.Nil(t, err)
+
+	var changed *config.Config
+	m.OnChange(func(c *config.Config) {
+		changed = c
+	})
+	ioutil.WriteFile(path, []byte(`{"max_players": 6, "max_rooms": 100}`), 0644)
+	restart, err := m.Reload()
+	assert.Nil(t, err)
+	assert.Empty(t, restart)
+	assert.Equal(t, 6, m.Get().MaxPlayers)
+	assert.Equal(t, 100, m.Get().MaxRooms)
+	assert.Equal(t, 6, changed.MaxPlayers, "Listeners are notified of the new configuration")
+}
+
+func TestConcurrentReloadsApplyInOrder(t *testing.T) {
+	path := writeConfig(t, `{"max_players": 4}`)
+	defer os.Remove(path)
+	m, err := config.NewManager(path)
+	assert.Nil(t, err)
+
+	var lock sync.Mutex
+	var applied []uint
+	m.OnChange(func(c *config.Config) {
+		lock.Lock()
+		applied = append(applied, c.MaxPlayers)
+		lock.Unlock()
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Reload()
+		}()
+	}
+	wg.Wait()
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Len(t, applied, 10)
+	assert.Equal(t, m.Get().MaxPlayers, applied[len(applied)-1],
+		"The last configuration announced is the one in use")
+}
+
+func TestReloadReportsSettingsRequiringRestart(t *testing.T) {
+	path := writeConfig(t, `{}`)
+	defer os.Remove(path)
+	m, err := config.NewManager(path)
+	assert.Nil(t, err)
+
+	ioutil.WriteFile(path, []byte(`{"service_address": "tcp://*:7002", "max_rooms": 10}`), 0644)
+	restart, err := m.Reload()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"service_address"}, restart)
+	assert.Equal(t, config.Default().ServiceAddress, m.Get().ServiceAddress,
+		"Settings requiring a restart keep their current value")
+	assert.Equal(t, 10, m.Get().MaxRooms)
+}
+
+func TestFailedReloadKeepsCurrentConfig(t *testing.T) {
+	path := writeConfig(t, `{"max_players": 5}`)
+	defer os.Remove(path)
+	m, err := config.NewManager(path)
+	assert.Nil(t, err)
+
+	ioutil.WriteFile(path, []byte(`{"max_players": 0}`), 0644)
+	_, err = m.Reload()
+	assert.NotNil(t, err)
+	assert.Equal(t, 5, m.Get().MaxPlayers)
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Manager keeps the current configuration and reloads it from a file on
+// request.
+// All the methods on manager are thread safe.
+type Manager struct {
+	path      string
+	current   *Config
+	listeners []func(*Config)
+	lock      *sync.Mutex
+	// reloadLock is held for a whole reload so concurrent reloads read,
+	// apply and announce their configurations one after the other.
+	reloadLock *sync.Mutex
+}
+
+// NewManager returns a new Manager with configuration loaded from path.
+// If path is empty default configuration is used and Reload only validates
+// the defaults again.
+func NewManager(path string) (*Manager, error) {
+	c, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		path:       path,
+		current:    c,
+		lock:       new(sync.Mutex),
+		reloadLock: new(sync.Mutex),
+	}, nil
+}
+
+func load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		var err error
+		c, err = Load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns a copy of the current configuration.
+func (m *Manager) Get() *Config {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c := *m.current
+	return &c
+}
+
+// OnChange registers a function f that is called with the new configuration
+// every time the configuration is successfully reloaded.
+func (m *Manager) OnChange(f func(*Config)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.listeners = append(m.listeners, f)
+}
+
+// Reload reads the configuration file again and applies the settings that
+// can be changed without a restart.
+// Names of the changed settings that require a restart to take effect are
+// returned. Those settings keep their current value until the service is
+// restarted. If the new configuration is invalid nothing is changed and an
+// error is returned.
+// Concurrent reloads run one at a time so the file read last is the one that
+// stays applied.
+func (m *Manager) Reload() ([]string, error) {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+	c, err := load(m.path)
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	restart := applyLive(m.current, c)
+	m.current = c
+	listeners := m.listeners
+	m.lock.Unlock()
+	for _, f := range listeners {
+		copied := *c
+		f(&copied)
+	}
+	return restart, nil
+}
+
+// applyLive copies settings that can not be changed without a restart from
+// old to c and returns the names of the ones that differ.
+func applyLive(old, c *Config) []string {
+	var restart []string
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(c).Elem()
+	configType := oldValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if field.Tag.Get("live") == "true" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			restart = append(restart, jsonName(field))
+			newValue.Field(i).Set(oldValue.Field(i))
+		}
+	}
+	return restart
+}
+
+// jsonName returns the name of the field used in the configuration file.
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,165 @@
+package lobby
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+)
+
+// Operations used by the service operators. Unlike the player operations they
+// act on any room regardless of its owner.
+
+var (
+	ErrRoomNotFound  = errors.New("Room does not exist")
+	ErrRoomFull      = errors.New("Room is full")
+	ErrAlreadyInRoom = errors.New("User is already in the room")
+)
+
+// RoomState is the full internal state of a room.
+type RoomState struct {
+	Room       *proto_lobby.Room
+	Starting   bool
+	InProgress bool
+	// JoinOrder are all the players in the order they joined the room.
+	JoinOrder []user.Id
+	// Ready and NotReady are the players that did and did not yet confirm
+	// the ready check in progress.
+	Ready    []user.Id
+	NotReady []user.Id
+	// ReadyDeadline is the end of the ready check in progress.
+	ReadyDeadline time.Time
+}
+
+// State returns the full internal state of the room.
+func (r *Room) State() RoomState {
+	s := r.load()
+	return RoomState{
+		Room:          s.proto,
+		Starting:      s.status == starting,
+		InProgress:    s.status == inProgress,
+		JoinOrder:     append([]user.Id(nil), s.joinOrder...),
+		Ready:         append([]user.Id(nil), s.ready...),
+		NotReady:      append([]user.Id(nil), s.notReady...),
+		ReadyDeadline: s.readyDeadline,
+	}
+}
+
+// RoomStates returns the full internal state of all the rooms.
+func (r *RoomList) RoomStates() []RoomState {
+	rooms := r.publishedRooms()
+	states := make([]RoomState, 0, len(rooms))
+	for _, room := range rooms {
+		states = append(states, room.State())
+	}
+	return states
+}
+
+// CloseRoom closes the room and removes all of its players.
+func (r *RoomList) CloseRoom(roomId RoomId) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[roomId]
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	log.Printf("Closing room [id=%s] by admin", roomId)
+	r.closeRoom(room, proto_lobby.RoomClosedEvent_CLOSED_BY_ADMIN)
+	return nil
+}
+
+// RemovePlayer removes the user from their room if it is at the expected
+// version. The ready check in progress is cancelled because players can't
+// leave while it is running.
+func (r *RoomList) RemovePlayer(userId user.Id, expectedVersion uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[r.players[userId]]
+	if room == nil {
+		return ErrNotInRoom
+	}
+	if err := checkVersion(room, expectedVersion); err != nil {
+		return err
+	}
+	return r.removePlayer(room, userId)
+}
+
+// CancelRoomStart cancels the ready check in the room if it is at the
+// expected version.
+func (r *RoomList) CancelRoomStart(roomId RoomId, expectedVersion uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[roomId]
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	if err := checkVersion(room, expectedVersion); err != nil {
+		return err
+	}
+	log.Printf("Cancelling the start of the game in room [id=%s] by admin", roomId)
+	if err := room.CancelStart(); err != nil {
+		return err
+	}
+	r.touchRoom(room)
+	return nil
+}
+
+// MovePlayer moves the user to another room. A user not in any room is added
+// to the room.
+func (r *RoomList) MovePlayer(userId user.Id, roomId RoomId) (*proto_lobby.Room, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	target := r.rooms[roomId]
+	if target == nil {
+		return nil, ErrRoomNotFound
+	}
+	room := r.rooms[r.players[userId]]
+	if room == target {
+		return nil, ErrAlreadyInRoom
+	}
+	if target.NumPlayers() >= target.MaxPlayers() {
+		return nil, ErrRoomFull
+	}
+	if room != nil {
+		if err := r.removePlayer(room, userId); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Moving user [id=%s] to room [id=%s] by admin", userId, roomId)
+	if err := r.join(target, userId); err != nil {
+		// The user goes back to the room they were moved from unless they
+		// were the last one in it.
+		if room != nil && r.rooms[room.GetId()] == room && r.join(room, userId) == nil {
+			log.Printf("Returned user [id=%s] to room [id=%s] after failing to move them", userId, room.GetId())
+		}
+		return nil, ErrRoomFull
+	}
+	roomProto := target.Proto()
+	r.notifyAsync(&proto_lobby.RoomSnapshotEvent{
+		Room: roomProto,
+	}, userId)
+	return roomProto, nil
+}
+
+// removePlayer cancels the ready check in the room if necessary and removes
+// the user from it.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) removePlayer(room *Room, userId user.Id) error {
+	if room.CancelStart() == nil {
+		log.Printf("Cancelled the start of the game in room [id=%s] to remove user [id=%s]", room.GetId(), userId)
+	}
+	log.Printf("Removing user [id=%s] from room [id=%s] by admin", userId, room.GetId())
+	if err := r.leave(room, userId); err != nil {
+		return err
+	}
+	r.notifyAsync(&proto_lobby.PlayerRemovedEvent{
+		RoomId: pbuf.String(room.GetId().String()),
+		Player: pbuf.String(userId.String()),
+		Reason: proto_lobby.PlayerRemovedEvent_REMOVED_BY_ADMIN.Enum(),
+	}, userId)
+	return nil
+}
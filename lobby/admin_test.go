@@ -0,0 +1,141 @@
+package lobby_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+func TestRoomStateKeepsJoinOrder(t *testing.T) {
+	room := lobby.NewRoom("room", "1", 4)
+	room.Join("3")
+	room.Join("2")
+	room.Join("4")
+	room.Leave("2")
+
+	state := room.State()
+	assert.Equal(t, []user.Id{"1", "3", "4"}, state.JoinOrder)
+	assert.False(t, state.Starting)
+}
+
+func TestRoomStateDuringReadyCheck(t *testing.T) {
+	room, _ := makeRoomWithClock()
+	room.Join("2")
+	room.Join("3")
+	userState, _ := room.StartGame()
+	room.PlayerReady("2", userState["2"])
+
+	state := room.State()
+	assert.True(t, state.Starting)
+	assert.Contains(t, state.Ready, user.Id("2"))
+	assert.Equal(t, []user.Id{"3"}, state.NotReady)
+	assert.False(t, state.ReadyDeadline.IsZero())
+}
+
+func TestCloseRoom(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	assert.Nil(t, roomList.CloseRoom(lobby.RoomId(room.GetId())))
+	assert.Nil(t, roomList.GetRoom(lobby.RoomId(room.GetId())))
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.RoomClosedEventMessage))
+	_, err := roomList.GetMyRoom("2")
+	assert.Equal(t, lobby.ErrNotInRoom, err)
+
+	assert.Equal(t, lobby.ErrRoomNotFound, roomList.CloseRoom(lobby.RoomId(room.GetId())))
+}
+
+func TestClosingRoomCancelsReadyCheckFirst(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomId := lobby.RoomId(room.GetId())
+	roomList.JoinRoom("2", roomId)
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+	var events []proto.Type
+	listed := false
+	roomList.AddEventListener(func(msg proto.ProtobufMessage, users []user.Id) {
+		events = append(events, msg.GetMessageType())
+		if msg.GetMessageType() == proto_lobby.ReadyCheckCancelledEventMessage {
+			listed = roomList.GetRoom(roomId) != nil
+		}
+	})
+
+	assert.Nil(t, roomList.CloseRoom(roomId))
+	if assert.NotEmpty(t, events) {
+		assert.Equal(t, proto_lobby.ReadyCheckCancelledEventMessage, events[0])
+	}
+	assert.True(t, listed, "The ready check is cancelled before the room is removed")
+}
+
+func TestRemovePlayerCancelsReadyCheck(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+
+	assert.Nil(t, roomList.RemovePlayer("2", lobby.AnyVersion))
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.ReadyCheckCancelledEventMessage))
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.PlayerRemovedEventMessage))
+	assert.Empty(t, roomList.GetRoom(lobby.RoomId(room.GetId())).GetPlayers())
+
+	assert.Equal(t, lobby.ErrNotInRoom, roomList.RemovePlayer("2", lobby.AnyVersion))
+}
+
+func TestRemovePlayerRejectsStaleVersion(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	joined, _ := roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.JoinRoom("3", lobby.RoomId(room.GetId()))
+
+	assert.Equal(t, lobby.ErrVersionConflict, roomList.RemovePlayer("2", joined.GetVersion()))
+	assert.Len(t, roomList.GetRoom(lobby.RoomId(room.GetId())).GetPlayers(), 2)
+	current := roomList.GetRoom(lobby.RoomId(room.GetId())).GetVersion()
+	assert.Nil(t, roomList.RemovePlayer("2", current))
+}
+
+func TestCancelRoomStart(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	assert.Equal(t, lobby.ErrNotStarting, roomList.CancelRoomStart(lobby.RoomId(room.GetId()), lobby.AnyVersion))
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+	assert.Nil(t, roomList.CancelRoomStart(lobby.RoomId(room.GetId()), lobby.AnyVersion))
+	assert.Equal(t, lobby.ErrRoomNotFound, roomList.CancelRoomStart("unknown", lobby.AnyVersion))
+}
+
+func TestMovePlayer(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room1, _ := roomList.CreateRoom("1", "room1", nil)
+	room2, _ := roomList.CreateRoom("2", "room2", nil)
+	roomList.JoinRoom("3", lobby.RoomId(room1.GetId()))
+
+	moved, err := roomList.MovePlayer("3", lobby.RoomId(room2.GetId()))
+	assert.Nil(t, err)
+	assert.Contains(t, moved.GetPlayers(), "3")
+	assert.Empty(t, roomList.GetRoom(lobby.RoomId(room1.GetId())).GetPlayers())
+
+	_, err = roomList.MovePlayer("3", lobby.RoomId(room2.GetId()))
+	assert.Equal(t, lobby.ErrAlreadyInRoom, err)
+	_, err = roomList.MovePlayer("3", "unknown")
+	assert.Equal(t, lobby.ErrRoomNotFound, err)
+}
+
+func TestMovePlayerToFullRoomKeepsSeat(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	limits := roomList.GetLimits()
+	limits.MaxPlayers = 1
+	roomList.SetLimits(limits)
+	room1, _ := roomList.CreateRoom("1", "room1", nil)
+	room2, _ := roomList.CreateRoom("2", "room2", nil)
+
+	_, err := roomList.MovePlayer("1", lobby.RoomId(room2.GetId()))
+	assert.Equal(t, lobby.ErrRoomFull, err)
+	assert.NotNil(t, roomList.GetRoom(lobby.RoomId(room1.GetId())))
+}
@@ -0,0 +1,117 @@
+package lobby
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opentarock/service-api/go/user"
+)
+
+// InvariantError lists every way the state of a RoomList is inconsistent.
+type InvariantError struct {
+	Violations []string
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("%d invariant violations: %s", len(e.Violations), strings.Join(e.Violations, "; "))
+}
+
+// CheckInvariants checks that the rooms and the players agree with each other
+// and that every room is consistent. It returns an *InvariantError listing
+// all the violations or nil if there are none.
+func (r *RoomList) CheckInvariants() error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var violations []string
+	for roomId, room := range r.rooms {
+		if room.GetId() != roomId {
+			violations = append(violations, fmt.Sprintf("room [id=%s] is listed as [id=%s]", room.GetId(), roomId))
+		}
+		members, roomViolations := room.checkInvariants()
+		violations = append(violations, roomViolations...)
+		for _, userId := range members {
+			if playerRoom, ok := r.players[userId]; !ok {
+				violations = append(violations, fmt.Sprintf("user [id=%s] in room [id=%s] is not in any room", userId, roomId))
+			} else if playerRoom != roomId {
+				violations = append(violations, fmt.Sprintf("user [id=%s] in room [id=%s] is in room [id=%s]", userId, roomId, playerRoom))
+			}
+		}
+	}
+	for userId, roomId := range r.players {
+		room := r.rooms[roomId]
+		if room == nil {
+			violations = append(violations, fmt.Sprintf("user [id=%s] is in room [id=%s] that does not exist", userId, roomId))
+		} else if _, ok := room.PlayerStatus(userId); !ok {
+			violations = append(violations, fmt.Sprintf("user [id=%s] is not a player of their room [id=%s]", userId, roomId))
+		}
+	}
+	for roomId := range r.idle {
+		if r.rooms[roomId] == nil {
+			violations = append(violations, fmt.Sprintf("room [id=%s] that does not exist has an idle timeout", roomId))
+		}
+	}
+	for roomId := range r.chats {
+		if r.rooms[roomId] == nil {
+			violations = append(violations, fmt.Sprintf("room [id=%s] that does not exist has a chat", roomId))
+		}
+	}
+	for roomId := range r.kicked {
+		if r.rooms[roomId] == nil {
+			violations = append(violations, fmt.Sprintf("room [id=%s] that does not exist has kicked players", roomId))
+		}
+	}
+	for roomId, vote := range r.votes {
+		if r.rooms[roomId] == nil {
+			violations = append(violations, fmt.Sprintf("room [id=%s] that does not exist has a vote", roomId))
+		} else if vote.target != "" && r.players[vote.target] != roomId {
+			violations = append(violations, fmt.Sprintf("vote in room [id=%s] targets user [id=%s] that is not in the room", roomId, vote.target))
+		}
+	}
+	if len(violations) > 0 {
+		return &InvariantError{violations}
+	}
+	return nil
+}
+
+// checkInvariants returns all the players in the room and the ways the room
+// is inconsistent. The state is checked by the room's goroutine.
+func (r *Room) checkInvariants() ([]user.Id, []string) {
+	var members []user.Id
+	var violations []string
+	violation := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf("room [id=%s] ", r.id)+fmt.Sprintf(format, args...))
+	}
+	err := r.do(func() error {
+		if r.owner == "" {
+			violation("has no owner")
+		}
+		if _, ok := r.players[r.owner]; ok {
+			violation("has owner [id=%s] among the other players", r.owner)
+		}
+		if r.numPlayers() > r.maxPlayers {
+			violation("has %d players, more than the maximum of %d", r.numPlayers(), r.maxPlayers)
+		}
+		members = append(members, r.owner)
+		for userId := range r.players {
+			members = append(members, userId)
+		}
+		if uint(len(r.joinOrder)) != r.numPlayers() {
+			violation("has %d players in the join order instead of %d", len(r.joinOrder), r.numPlayers())
+		}
+		for _, userId := range r.joinOrder {
+			if _, ok := r.players[userId]; !ok && userId != r.owner {
+				violation("has user [id=%s] in the join order that is not a player", userId)
+			}
+		}
+		if (r.status == starting) != (r.ready != nil) {
+			violation("is starting=%t but has ready check=%t", r.status == starting, r.ready != nil)
+		}
+		return nil
+	})
+	if err != nil {
+		// The last snapshot still has the players of a closed room.
+		violation("is closed")
+		members = r.GetUserIds()
+	}
+	return members, violations
+}
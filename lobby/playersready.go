@@ -16,22 +16,39 @@ type PlayersReady struct {
 	owner           user.Id
 	playerState     map[user.Id]string
 	playersReady    map[user.Id]bool
+	policy          ReadyPolicy
+	complete        bool
 	timeout         *util.CancellableTimeout
+	deadline        time.Time
 	id              string
 	successCallback func()
+	Clock           util.Clock // Clock measures the ready timeout.
 	lock            *sync.Mutex
 }
 
 // NewPlayersReady return a new PlayersReady  with expected player state and callback function f
 // that is executed when all te players are ready.
 func NewPlayersReady(owner user.Id, playerState map[user.Id]string, f func()) *PlayersReady {
+	return NewPlayersReadyWithPolicy(owner, playerState, AllReady(), f)
+}
+
+// NewPlayersReadyWithPolicy returns a new PlayersReady that executes callback
+// function f when the ready policy is satisfied. f may be nil.
+func NewPlayersReadyWithPolicy(
+	owner user.Id,
+	playerState map[user.Id]string,
+	policy ReadyPolicy,
+	f func()) *PlayersReady {
+
 	id := uuid.New()
 	ready := &PlayersReady{
 		owner:           owner,
 		playerState:     playerState,
 		playersReady:    make(map[user.Id]bool),
+		policy:          policy,
 		id:              id,
 		successCallback: f,
+		Clock:           util.RealClock(),
 		lock:            new(sync.Mutex),
 	}
 	return ready
@@ -41,11 +58,19 @@ func NewPlayersReady(owner user.Id, playerState map[user.Id]string, f func()) *P
 func (r *PlayersReady) Start(timeout time.Duration, f func(timeoutId string)) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	r.timeout = util.StartCancellableTimeout(timeout, func() {
+	r.deadline = r.Clock.Now().Add(timeout)
+	r.timeout = util.StartCancellableTimeoutWithClock(r.Clock, timeout, func() {
 		f(r.id)
 	})
 }
 
+// Deadline returns the time the ready timeout ends.
+func (r *PlayersReady) Deadline() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.deadline
+}
+
 // GetId returns a unique id.
 func (r *PlayersReady) GetId() string {
 	return r.id
@@ -72,7 +97,8 @@ var ErrUnknownUser = errors.New("unknown user.")
 
 // Ready marks a user with user id as ready if the state matches the expected state
 // for that user.
-// If all the users are ready room's game is started.
+// If the ready policy is satisfied the process is complete and the success
+// callback is executed.
 func (r *PlayersReady) Ready(userId user.Id, stateReceived string) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
@@ -88,13 +114,82 @@ func (r *PlayersReady) Ready(userId user.Id, stateReceived string) error {
 	} else {
 		return ErrUnknownUser
 	}
-	if len(r.playerState) == len(r.playersReady) {
+	if !r.complete && r.policy.Satisfied(r.numReady(), r.numPlayers()) {
+		r.complete = true
 		r.timeout.Cancel()
-		r.successCallback()
+		if r.successCallback != nil {
+			r.successCallback()
+		}
 	}
 	return nil
 }
 
+// numReady returns the number of ready players including the owner.
+func (r *PlayersReady) numReady() uint {
+	return uint(1 + len(r.playersReady))
+}
+
+// numPlayers returns the number of players including the owner.
+func (r *PlayersReady) numPlayers() uint {
+	return uint(1 + len(r.playerState))
+}
+
+// IsComplete returns true if the ready policy has been satisfied.
+func (r *PlayersReady) IsComplete() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.complete
+}
+
+// StartOnTimeout returns true if the ready policy allows starting the game
+// with the players that are currently ready when the timeout ends.
+func (r *PlayersReady) StartOnTimeout() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.policy.StartOnTimeout(r.numReady(), r.numPlayers())
+}
+
+// CanForce returns true if the ready policy allows the owner to start the
+// game before the policy is satisfied.
+func (r *PlayersReady) CanForce() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.policy.OwnerCanForce()
+}
+
+// ReadyUsers returns ids of the users that are ready including the owner.
+func (r *PlayersReady) ReadyUsers() []user.Id {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]user.Id, 0, 1+len(r.playersReady))
+	result = append(result, r.owner)
+	for userId, _ := range r.playersReady {
+		result = append(result, userId)
+	}
+	return result
+}
+
+// NotReady returns ids of the users that did not confirm they are ready.
+func (r *PlayersReady) NotReady() []user.Id {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]user.Id, 0, len(r.playerState)-len(r.playersReady))
+	for userId, _ := range r.playerState {
+		if !r.playersReady[userId] {
+			result = append(result, userId)
+		}
+	}
+	return result
+}
+
+// IsReady returns true if the user confirmed they are ready. The owner is
+// always ready.
+func (r *PlayersReady) IsReady(userId user.Id) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return userId == r.owner || r.playersReady[userId]
+}
+
 // HasUser checks if a user is part of this ready process.
 func (r *PlayersReady) HasUser(userId user.Id) bool {
 	r.lock.Lock()
@@ -6,6 +6,7 @@ import (
 
 	"github.com/opentarock/service-api/go/user"
 	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -98,10 +99,64 @@ func TestSuccessCallbackIsExecutedWhenAllThePLayersAreReady(t *testing.T) {
 
 func TestTimeoutCallbackIsExecuted(t *testing.T) {
 	pr := MakePlayersReady()
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	pr.Clock = clock
+	timeoutId := ""
+	pr.Start(defaultTimeout, func(id string) {
+		timeoutId = id
+	})
+	assert.Equal(t, clock.Now().Add(defaultTimeout), pr.Deadline())
+	clock.Advance(defaultTimeout)
+	assert.Equal(t, pr.GetId(), timeoutId, "Timeout callback should receive the id")
+}
+
+func TestTimeoutCallbackIsNotExecutedAfterCancel(t *testing.T) {
+	pr := MakePlayersReady()
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	pr.Clock = clock
 	timeout := false
-	pr.Start(100*time.Millisecond, func(t string) {
+	pr.Start(defaultTimeout, func(id string) {
 		timeout = true
 	})
-	time.Sleep(200 * time.Millisecond)
-	assert.True(t, timeout, "Timeout callback should set it to true")
+	pr.Cancel()
+	clock.Advance(defaultTimeout)
+	assert.False(t, timeout)
+}
+
+func TestQuorumPolicyCompletesBeforeEveryoneIsReady(t *testing.T) {
+	pr := lobby.NewPlayersReadyWithPolicy(user.Id("1"), state, lobby.QuorumReady(2), nil)
+	pr.Start(defaultTimeout, func(t string) {})
+	defer pr.Cancel()
+	assert.False(t, pr.IsComplete())
+
+	err := pr.Ready("2", state["2"])
+	assert.Nil(t, err)
+	assert.True(t, pr.IsComplete(), "Owner and one player make a quorum of 2")
+	assert.Equal(t, []user.Id{"3"}, pr.NotReady())
+}
+
+func TestAllReadyPolicyRequiresEveryone(t *testing.T) {
+	pr := MakePlayersReady()
+	pr.Start(defaultTimeout, func(t string) {})
+	defer pr.Cancel()
+
+	pr.Ready("2", state["2"])
+	assert.False(t, pr.IsComplete())
+	assert.False(t, pr.StartOnTimeout())
+	assert.False(t, pr.CanForce())
+	pr.Ready("3", state["3"])
+	assert.True(t, pr.IsComplete())
+	assert.Empty(t, pr.NotReady())
+}
+
+func TestDropNotReadyPolicyStartsOnTimeout(t *testing.T) {
+	pr := lobby.NewPlayersReadyWithPolicy(user.Id("1"), state, lobby.DropNotReadyOnTimeout(), nil)
+	assert.True(t, pr.StartOnTimeout())
+	assert.False(t, pr.CanForce())
+}
+
+func TestOwnerForcePolicyAllowsForcing(t *testing.T) {
+	pr := lobby.NewPlayersReadyWithPolicy(user.Id("1"), state, lobby.OwnerForceStart(), nil)
+	assert.True(t, pr.CanForce())
+	assert.False(t, pr.StartOnTimeout())
 }
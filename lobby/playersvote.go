@@ -0,0 +1,233 @@
+package lobby
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/util"
+
+	"code.google.com/p/go-uuid/uuid"
+)
+
+// VoteResult is the outcome of a vote.
+type VoteResult int
+
+const (
+	VotePending VoteResult = iota
+	VotePassed
+	VoteFailed
+)
+
+// PlayersVote is a helper for collecting the votes of players on a proposal.
+// The vote passes once the threshold percentage of the voters voted yes and
+// fails once that is no longer possible or the timeout ends first.
+type PlayersVote struct {
+	voters    map[user.Id]bool
+	votes     map[user.Id]bool
+	threshold uint
+	result    VoteResult
+	timeout   *util.CancellableTimeout
+	deadline  time.Time
+	id        string
+	Clock     util.Clock // Clock measures the vote timeout.
+	// MinYes is the least number of yes votes needed to pass, whatever the
+	// threshold.
+	MinYes uint
+	lock   *sync.Mutex
+}
+
+// NewPlayersVote returns a new PlayersVote of the voters that passes once
+// threshold percent of them voted yes.
+func NewPlayersVote(voters []user.Id, threshold uint) *PlayersVote {
+	vote := &PlayersVote{
+		voters:    make(map[user.Id]bool),
+		votes:     make(map[user.Id]bool),
+		threshold: threshold,
+		id:        uuid.New(),
+		Clock:     util.RealClock(),
+		lock:      new(sync.Mutex),
+	}
+	for _, userId := range voters {
+		vote.voters[userId] = true
+	}
+	return vote
+}
+
+// Start starts collecting the votes. If the vote is not decided before the
+// timeout ends it fails and f is called with the id of the vote.
+func (v *PlayersVote) Start(timeout time.Duration, f func(voteId string)) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.deadline = v.Clock.Now().Add(timeout)
+	v.timeout = util.StartCancellableTimeoutWithClock(v.Clock, timeout, func() {
+		v.lock.Lock()
+		if v.result == VotePending {
+			v.result = VoteFailed
+		}
+		v.lock.Unlock()
+		f(v.id)
+	})
+}
+
+// Deadline returns the time the vote timeout ends.
+func (v *PlayersVote) Deadline() time.Time {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.deadline
+}
+
+// GetId returns a unique id.
+func (v *PlayersVote) GetId() string {
+	return v.id
+}
+
+// ErrAlreadyVoted is returned by Vote if the user already voted.
+var ErrAlreadyVoted = errors.New("User already voted.")
+
+// ErrVoteEnded is returned by Vote if the vote was already decided.
+var ErrVoteEnded = errors.New("Vote already ended.")
+
+// Vote records the user's vote. It returns ErrUnknownUser if the user is not
+// one of the voters.
+// If the vote is decided by it the timeout is cancelled.
+func (v *PlayersVote) Vote(userId user.Id, yes bool) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.result != VotePending {
+		return ErrVoteEnded
+	}
+	if !v.voters[userId] {
+		return ErrUnknownUser
+	}
+	if _, ok := v.votes[userId]; ok {
+		return ErrAlreadyVoted
+	}
+	v.votes[userId] = yes
+	v.decide()
+	return nil
+}
+
+// RemoveVoter removes the user from the voters together with their vote.
+// Fewer votes are needed afterwards so this can decide the vote.
+func (v *PlayersVote) RemoveVoter(userId user.Id) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.result != VotePending || !v.voters[userId] {
+		return
+	}
+	delete(v.voters, userId)
+	delete(v.votes, userId)
+	v.decide()
+}
+
+// decide ends the vote if enough voters voted yes or if the voters that did
+// not vote yet can't make it pass anymore.
+// This method should only be called while owning the vote's lock.
+func (v *PlayersVote) decide() {
+	yes := uint(0)
+	for _, vote := range v.votes {
+		if vote {
+			yes++
+		}
+	}
+	needed := v.needed()
+	if yes >= needed {
+		v.result = VotePassed
+	} else if yes+uint(len(v.voters)-len(v.votes)) < needed {
+		v.result = VoteFailed
+	} else {
+		return
+	}
+	if v.timeout != nil {
+		v.timeout.Cancel()
+	}
+}
+
+// needed returns the number of yes votes needed to pass, at least one and
+// at least MinYes.
+// This method should only be called while owning the vote's lock.
+func (v *PlayersVote) needed() uint {
+	needed := (v.threshold*uint(len(v.voters)) + 99) / 100
+	if needed < v.MinYes {
+		needed = v.MinYes
+	}
+	if needed == 0 {
+		needed = 1
+	}
+	return needed
+}
+
+// Needed returns the number of yes votes needed to pass.
+func (v *PlayersVote) Needed() uint {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.needed()
+}
+
+// Result returns the result of the vote, VotePending until it is decided.
+func (v *PlayersVote) Result() VoteResult {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.result
+}
+
+// Voters returns ids of the users that can vote.
+func (v *PlayersVote) Voters() []user.Id {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	result := make([]user.Id, 0, len(v.voters))
+	for userId := range v.voters {
+		result = append(result, userId)
+	}
+	return sortUsers(result)
+}
+
+// Yes returns ids of the users that voted yes.
+func (v *PlayersVote) Yes() []user.Id {
+	return v.voted(true)
+}
+
+// No returns ids of the users that voted no.
+func (v *PlayersVote) No() []user.Id {
+	return v.voted(false)
+}
+
+func (v *PlayersVote) voted(yes bool) []user.Id {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	result := make([]user.Id, 0, len(v.votes))
+	for userId, vote := range v.votes {
+		if vote == yes {
+			result = append(result, userId)
+		}
+	}
+	return sortUsers(result)
+}
+
+// HasUser checks if a user is one of the voters.
+func (v *PlayersVote) HasUser(userId user.Id) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.voters[userId]
+}
+
+// Cancel cancels the vote timeout. Users can still vote, just without a
+// timeout.
+func (v *PlayersVote) Cancel() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.timeout != nil {
+		v.timeout.Cancel()
+	}
+}
+
+// sortUsers sorts the user ids so they are always listed in the same order.
+func sortUsers(userIds []user.Id) []user.Id {
+	sort.Slice(userIds, func(i, j int) bool {
+		return userIds[i] < userIds[j]
+	})
+	return userIds
+}
@@ -0,0 +1,78 @@
+package lobby_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var voters = []user.Id{"1", "2", "3", "4"}
+
+func TestVotePassesAtThreshold(t *testing.T) {
+	v := lobby.NewPlayersVote(voters, 60)
+	v.Start(defaultTimeout, func(voteId string) {})
+	defer v.Cancel()
+	assert.Equal(t, uint(3), v.Needed())
+
+	assert.NoError(t, v.Vote("1", true))
+	assert.NoError(t, v.Vote("2", true))
+	assert.Equal(t, lobby.VotePending, v.Result())
+	assert.NoError(t, v.Vote("3", true))
+	assert.Equal(t, lobby.VotePassed, v.Result())
+	assert.Equal(t, lobby.ErrVoteEnded, v.Vote("4", true))
+}
+
+func TestVoteFailsWhenItCantPass(t *testing.T) {
+	v := lobby.NewPlayersVote(voters, 60)
+	v.Start(defaultTimeout, func(voteId string) {})
+	defer v.Cancel()
+
+	assert.NoError(t, v.Vote("1", false))
+	assert.Equal(t, lobby.VotePending, v.Result())
+	assert.NoError(t, v.Vote("2", false))
+	assert.Equal(t, lobby.VoteFailed, v.Result())
+	assert.Equal(t, []user.Id{"1", "2"}, v.No())
+}
+
+func TestOnlyVotersCanVoteOnce(t *testing.T) {
+	v := lobby.NewPlayersVote(voters, 60)
+	v.Start(defaultTimeout, func(voteId string) {})
+	defer v.Cancel()
+
+	assert.Equal(t, lobby.ErrUnknownUser, v.Vote("5", true))
+	assert.NoError(t, v.Vote("1", true))
+	assert.Equal(t, lobby.ErrAlreadyVoted, v.Vote("1", false))
+	assert.Equal(t, []user.Id{"1"}, v.Yes())
+}
+
+func TestVoteFailsOnTimeout(t *testing.T) {
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	v := lobby.NewPlayersVote(voters, 60)
+	v.Clock = clock
+	timedOut := ""
+	v.Start(defaultTimeout, func(voteId string) {
+		timedOut = voteId
+	})
+	v.Vote("1", true)
+
+	clock.Advance(defaultTimeout)
+	assert.Equal(t, v.GetId(), timedOut)
+	assert.Equal(t, lobby.VoteFailed, v.Result())
+}
+
+func TestRemovingVoterCanPassVote(t *testing.T) {
+	v := lobby.NewPlayersVote(voters, 60)
+	v.Start(defaultTimeout, func(voteId string) {})
+	defer v.Cancel()
+	v.Vote("1", true)
+	v.Vote("2", true)
+
+	v.RemoveVoter("4")
+	assert.False(t, v.HasUser("4"))
+	assert.Equal(t, uint(2), v.Needed())
+	assert.Equal(t, lobby.VotePassed, v.Result())
+}
@@ -0,0 +1,180 @@
+package lobby
+
+import (
+	"log"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// presence tracks whether a user is connected to the lobby.
+// A user is online while they have an open session or keep sending
+// heartbeats. Users that never sent a presence signal are not tracked and
+// are never removed from their room.
+type presence struct {
+	// conns is the number of open sessions reported by the gateways.
+	conns int
+	// heartbeat expires when the user stops sending heartbeats.
+	heartbeat *util.ScheduledTask
+	// removal removes the user from their room at the end of the grace
+	// period, it is only set while the user is offline.
+	removal *util.ScheduledTask
+}
+
+func (p *presence) online() bool {
+	return p.conns > 0 || p.heartbeat != nil
+}
+
+// Connected reports that a user opened a session with a gateway.
+// Sessions are counted so a user connected through multiple gateways is only
+// offline after all of them are closed.
+func (r *RoomList) Connected(userId user.Id) {
+	r.updatePresence(userId, func(p *presence) {
+		p.conns++
+	})
+}
+
+// Disconnected reports that a session opened with Connected was closed.
+func (r *RoomList) Disconnected(userId user.Id) {
+	r.updatePresence(userId, func(p *presence) {
+		if p.conns > 0 {
+			p.conns--
+		}
+	})
+}
+
+// Heartbeat reports that a user is still connected. If no heartbeat is
+// received within HeartbeatTimeout the user is considered disconnected.
+func (r *RoomList) Heartbeat(userId user.Id) {
+	timeout := r.GetLimits().HeartbeatTimeout
+	r.updatePresence(userId, func(p *presence) {
+		if p.heartbeat != nil && p.heartbeat.Reschedule(timeout) {
+			return
+		}
+		var task *util.ScheduledTask
+		task = r.scheduler.Schedule(timeout, func() {
+			r.updatePresence(userId, func(p *presence) {
+				if p.heartbeat == task {
+					p.heartbeat = nil
+				}
+			})
+		})
+		p.heartbeat = task
+	})
+}
+
+// updatePresence applies change to the user's presence and handles the user
+// going offline or coming back online.
+func (r *RoomList) updatePresence(userId user.Id, change func(p *presence)) {
+	r.presenceLock.Lock()
+	p, ok := r.presence[userId]
+	if !ok {
+		p = &presence{}
+		r.presence[userId] = p
+	}
+	wasOnline := ok && p.online()
+	change(p)
+	online := p.online()
+	reconnected := online && p.removal != nil
+	disconnected := !online && wasOnline
+	if reconnected {
+		p.removal.Stop()
+		p.removal = nil
+	}
+	if disconnected {
+		r.scheduleRemoval(userId, p)
+	}
+	if !online && p.removal == nil {
+		delete(r.presence, userId)
+	}
+	r.presenceLock.Unlock()
+
+	room := r.getPlayerRoom(userId)
+	if room == nil {
+		return
+	}
+	// An empty list of users would broadcast the event to everyone.
+	others := excludeUser(room.GetUserIds(), userId)
+	if disconnected {
+		log.Printf("User [id=%s] in room [id=%s] disconnected", userId, room.GetId())
+		if len(others) > 0 {
+			r.notifyAsync(&proto_lobby.PlayerDisconnectedEvent{
+				RoomId: pbuf.String(room.GetId().String()),
+				Player: pbuf.String(userId.String()),
+			}, others...)
+		}
+	}
+	if reconnected {
+		log.Printf("User [id=%s] reconnected to room [id=%s]", userId, room.GetId())
+		if len(others) > 0 {
+			r.notifyAsync(&proto_lobby.PlayerReconnectedEvent{
+				RoomId: pbuf.String(room.GetId().String()),
+				Player: pbuf.String(userId.String()),
+			}, others...)
+		}
+		r.notifyAsync(&proto_lobby.RoomSnapshotEvent{
+			Room: room.Proto(),
+		}, userId)
+	}
+}
+
+// scheduleRemoval removes the user from their room unless they come back
+// online within the disconnect grace period.
+// This method should only be called while owning the presence lock.
+func (r *RoomList) scheduleRemoval(userId user.Id, p *presence) {
+	var task *util.ScheduledTask
+	task = r.scheduler.Schedule(r.GetLimits().DisconnectGrace, func() {
+		r.presenceLock.Lock()
+		if p.removal != task {
+			r.presenceLock.Unlock()
+			return
+		}
+		delete(r.presence, userId)
+		r.presenceLock.Unlock()
+		r.removeDisconnected(userId, p)
+	})
+	p.removal = task
+}
+
+// removeDisconnected removes a user that did not reconnect in time from their
+// room. Players can't leave while the ready check is in progress so the
+// removal is tried again after another grace period.
+func (r *RoomList) removeDisconnected(userId user.Id, p *presence) {
+	room := r.getPlayerRoom(userId)
+	if room == nil {
+		return
+	}
+	ok, errCode := r.LeaveRoom(userId)
+	if errCode == proto_lobby.LeaveRoomResponse_GAME_STARTING {
+		r.presenceLock.Lock()
+		if _, ok := r.presence[userId]; !ok {
+			r.presence[userId] = p
+			r.scheduleRemoval(userId, p)
+		}
+		r.presenceLock.Unlock()
+		return
+	}
+	if !ok {
+		return
+	}
+	log.Printf("User [id=%s] did not reconnect and was removed from room [id=%s]", userId, room.GetId())
+	r.notifyAsync(&proto_lobby.PlayerRemovedEvent{
+		RoomId: pbuf.String(room.GetId().String()),
+		Player: pbuf.String(userId.String()),
+		Reason: proto_lobby.PlayerRemovedEvent_DISCONNECTED.Enum(),
+	}, userId)
+}
+
+// excludeUser returns userIds without userId.
+func excludeUser(userIds []user.Id, userId user.Id) []user.Id {
+	result := make([]user.Id, 0, len(userIds))
+	for _, id := range userIds {
+		if id != userId {
+			result = append(result, id)
+		}
+	}
+	return result
+}
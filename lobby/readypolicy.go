@@ -0,0 +1,104 @@
+package lobby
+
+import "github.com/opentarock/service-api/go/proto_lobby"
+
+// ReadyPolicy decides when the game in a room can start based on the number
+// of players that confirmed they are ready.
+// Player counts include the owner who is always considered ready.
+// When the game starts players that did not confirm are removed from the room.
+type ReadyPolicy interface {
+	// Satisfied returns true if the game can start before the timeout.
+	Satisfied(numReady, numPlayers uint) bool
+	// StartOnTimeout returns true if the game should start anyway when the
+	// ready timeout ends.
+	StartOnTimeout(numReady, numPlayers uint) bool
+	// OwnerCanForce returns true if the owner may start the game before the
+	// policy is satisfied.
+	OwnerCanForce() bool
+}
+
+// AllReady returns the default policy that requires every player to confirm.
+func AllReady() ReadyPolicy {
+	return allReady{}
+}
+
+type allReady struct{}
+
+func (allReady) Satisfied(numReady, numPlayers uint) bool {
+	return numReady == numPlayers
+}
+
+func (allReady) StartOnTimeout(numReady, numPlayers uint) bool {
+	return false
+}
+
+func (allReady) OwnerCanForce() bool {
+	return false
+}
+
+// QuorumReady returns a policy that starts the game as soon as n players are
+// ready. If there are fewer than n players in the room all of them must
+// confirm.
+func QuorumReady(n uint) ReadyPolicy {
+	return quorumReady{n}
+}
+
+type quorumReady struct {
+	n uint
+}
+
+func (p quorumReady) Satisfied(numReady, numPlayers uint) bool {
+	return numReady >= p.n || numReady == numPlayers
+}
+
+func (quorumReady) StartOnTimeout(numReady, numPlayers uint) bool {
+	return false
+}
+
+func (quorumReady) OwnerCanForce() bool {
+	return false
+}
+
+// DropNotReadyOnTimeout returns a policy that requires every player to
+// confirm, but when the timeout ends starts the game anyway without the
+// players that did not.
+func DropNotReadyOnTimeout() ReadyPolicy {
+	return dropNotReady{}
+}
+
+type dropNotReady struct {
+	allReady
+}
+
+func (dropNotReady) StartOnTimeout(numReady, numPlayers uint) bool {
+	return true
+}
+
+// OwnerForceStart returns a policy that requires every player to confirm but
+// lets the owner start the game before they do.
+func OwnerForceStart() ReadyPolicy {
+	return ownerForce{}
+}
+
+type ownerForce struct {
+	allReady
+}
+
+func (ownerForce) OwnerCanForce() bool {
+	return true
+}
+
+// ReadyPolicyFromOptions returns the ready policy selected in room options.
+func ReadyPolicyFromOptions(options *proto_lobby.RoomOptions) ReadyPolicy {
+	switch options.GetReadyPolicy() {
+	case proto_lobby.RoomOptions_QUORUM:
+		if options.GetReadyQuorum() > 0 {
+			return QuorumReady(uint(options.GetReadyQuorum()))
+		}
+	case proto_lobby.RoomOptions_DROP_NOT_READY:
+		return DropNotReadyOnTimeout()
+	case proto_lobby.RoomOptions_OWNER_FORCE:
+		return OwnerForceStart()
+	}
+	return AllReady()
+}
@@ -1,10 +1,12 @@
 package lobby
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.google.com/p/go-uuid/uuid"
@@ -31,33 +33,148 @@ const (
 )
 
 // Room represents a game room allowing joining and leaving of users.
+// The state of a room is owned by its own goroutine, an actor, that runs the
+// commands changing it one at a time. After every command the room publishes
+// an immutable snapshot of its state that the methods reading it use, so
+// reading never waits for a command to finish.
 // All the methods on room are thread safe.
 type Room struct {
-	id           RoomId
-	name         string
-	options      *proto_lobby.RoomOptions
-	owner        user.Id
-	maxPlayers   uint
-	players      map[user.Id]string
-	status       roomStatus
-	ready        *PlayersReady
+	id RoomId
+	// The fields below are only accessed by the room's goroutine.
+	name       string
+	options    *proto_lobby.RoomOptions
+	maxPlayers uint
+	owner      user.Id
+	players    map[user.Id]string
+	// joinOrder are the ids of all the players, including the owner, in the
+	// order they joined the room.
+	joinOrder []user.Id
+	status    roomStatus
+	ready     *PlayersReady
+	// readyPolicy is selected by the room's options.
+	readyPolicy ReadyPolicy
+	pending     roomNotifications
+	// The exported fields must be set before the room is used.
 	ReadyTimeout time.Duration
-	lock         *sync.Mutex // Because room pointers are shared we must own a lock before reading or writing its data.
+	Clock        util.Clock
+	// ListLock, if set, is locked before the room's command runs when the
+	// ready check times out. The RoomList sets it to its own lock so the
+	// players dropped by the timeout are removed from the list in the same
+	// step.
+	ListLock sync.Locker
+	// PlayersDropped is called with the ids of players that were removed from
+	// the room because they did not confirm they are ready. It is called
+	// after the command that removed them finished.
+	PlayersDropped func(room *Room, userIds []user.Id)
+	// ReadyCheckChanged is called when the ready check starts, progresses,
+	// fails or is cancelled. It is called after the command that changed the
+	// ready check finished.
+	ReadyCheckChanged func(room *Room, change ReadyCheckChange)
+	// mailbox receives the commands run by the room's goroutine.
+	mailbox chan roomCommand
+	// closed is closed to stop the room's goroutine.
+	closed    chan struct{}
+	closeOnce *sync.Once
+	// snapshot is the *roomSnapshot published after the last command that
+	// changed the room.
+	snapshot atomic.Value
+	versions *versions
+}
+
+// roomCommand is a function run by the room's goroutine. The notifications
+// it collected are sent to done once it finishes.
+type roomCommand struct {
+	f    func() error
+	err  error
+	done chan roomCommand
+	// pending are the notifications collected by f.
+	pending roomNotifications
+}
+
+// roomSnapshot is the state of a room at the end of a command. It must not be
+// modified once published.
+type roomSnapshot struct {
+	// version increases whenever the room changes.
+	version    uint64
+	proto      *proto_lobby.Room
+	name       string
+	options    *proto_lobby.RoomOptions
+	maxPlayers uint
+	owner      user.Id
+	joinOrder  []user.Id
+	// players are the players except the owner in the order they joined.
+	players []user.Id
+	states  map[user.Id]string
+	status  roomStatus
+	// ready and notReady are the players that did and did not yet confirm
+	// the ready check in progress.
+	ready         []user.Id
+	notReady      []user.Id
+	readyDeadline time.Time
+}
+
+// ReadyCheckStatus is the kind of change in a room's ready check.
+type ReadyCheckStatus int
+
+const (
+	ReadyCheckStarted ReadyCheckStatus = iota
+	ReadyCheckProgress
+	ReadyCheckFailed
+	ReadyCheckCancelled
+)
+
+// ReadyCheckChange describes a change in the ready check of a room.
+type ReadyCheckChange struct {
+	Status ReadyCheckStatus
+	// Deadline is the time the ready check ends, only set when it starts.
+	Deadline time.Time
+	// Users are the users that confirmed they are ready on progress and the
+	// users that did not confirm when the ready check fails.
+	Users []user.Id
+}
+
+// roomNotifications are collected while a command runs and delivered to the
+// room's callbacks once it finished.
+type roomNotifications struct {
+	dropped    []user.Id
+	readyCheck []ReadyCheckChange
 }
 
 // NewRoom returns a new Room with a given name, owner and max players allowed.
 // Room id is automatically generated and can be accessed using GetId().
+// The room's goroutine runs until the room is closed.
 func NewRoom(name string, owner user.Id, maxPlayers uint) *Room {
-	return &Room{
+	return newRoom(name, owner, maxPlayers, nil, newVersions())
+}
+
+// newRoom returns a new Room with its versions taken from versions.
+func newRoom(
+	name string,
+	owner user.Id,
+	maxPlayers uint,
+	options *proto_lobby.RoomOptions,
+	versions *versions) *Room {
+
+	r := &Room{
 		id:           newRoomId(),
 		name:         name,
+		options:      options,
 		owner:        owner,
 		maxPlayers:   maxPlayers,
 		players:      make(map[user.Id]string),
+		joinOrder:    []user.Id{owner},
 		status:       notStarted,
+		readyPolicy:  ReadyPolicyFromOptions(options),
 		ReadyTimeout: readyTimeout,
-		lock:         new(sync.Mutex),
+		Clock:        util.RealClock(),
+		mailbox:      make(chan roomCommand),
+		closed:       make(chan struct{}),
+		closeOnce:    new(sync.Once),
+		versions:     versions,
 	}
+	r.publish()
+	go r.run()
+	return r
 }
 
 // newRoomId generates a unique id.
@@ -65,6 +182,140 @@ func newRoomId() RoomId {
 	return RoomId(uuid.New())
 }
 
+// ErrRoomClosed is returned by the methods changing a room after it was
+// closed.
+var ErrRoomClosed = errors.New("Room is closed")
+
+// run runs the commands sent to the room until it is closed.
+func (r *Room) run() {
+	for {
+		select {
+		case cmd := <-r.mailbox:
+			cmd.err = cmd.f()
+			r.publish()
+			cmd.pending = r.pending
+			r.pending = roomNotifications{}
+			cmd.done <- cmd
+		case <-r.closed:
+			return
+		}
+	}
+}
+
+// do runs f on the room's goroutine and returns its error once it finishes.
+// The notifications collected by f are then delivered to the room's callbacks.
+// If the room is closed f is not run and ErrRoomClosed is returned.
+func (r *Room) do(f func() error) error {
+	cmd := roomCommand{f: f, done: make(chan roomCommand, 1)}
+	select {
+	case r.mailbox <- cmd:
+	case <-r.closed:
+		return ErrRoomClosed
+	}
+	cmd = <-cmd.done
+	r.notify(cmd.pending)
+	return cmd.err
+}
+
+// Close stops the room's goroutine. The room can still be read but all the
+// changes fail with ErrRoomClosed.
+func (r *Room) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+}
+
+// publish publishes a snapshot of the room's current state with a new version
+// and protobuf representation, unless the state did not change since the last
+// snapshot.
+// This method should only be called by the room's goroutine.
+func (r *Room) publish() {
+	s := &roomSnapshot{
+		name:       r.name,
+		options:    r.options,
+		maxPlayers: r.maxPlayers,
+		owner:      r.owner,
+		joinOrder:  append([]user.Id(nil), r.joinOrder...),
+		players:    make([]user.Id, 0, len(r.players)),
+		states:     copyMap(r.players),
+		status:     r.status,
+	}
+	for _, userId := range r.joinOrder {
+		if userId != r.owner {
+			s.players = append(s.players, userId)
+		}
+	}
+	if r.ready != nil {
+		s.ready = r.ready.ReadyUsers()
+		s.notReady = r.ready.NotReady()
+		s.readyDeadline = r.ready.Deadline()
+	}
+	if last, ok := r.snapshot.Load().(*roomSnapshot); ok && last.sameState(s) {
+		return
+	}
+	r.versions.publish(func(version uint64) {
+		s.version = version
+		s.proto = &proto_lobby.Room{
+			Id:      pbuf.String(r.id.String()),
+			Name:    pbuf.String(s.name),
+			Options: publicOptions(s.options),
+			Owner:   pbuf.String(s.owner.String()),
+			Players: toStringSlice(s.players),
+			Version: pbuf.Uint64(version),
+		}
+		if s.options.GetPassword() != "" {
+			s.proto.HasPassword = pbuf.Bool(true)
+		}
+		r.snapshot.Store(s)
+	})
+}
+
+// publicOptions returns the options without the password, the snapshots
+// are sent to everyone.
+func publicOptions(options *proto_lobby.RoomOptions) *proto_lobby.RoomOptions {
+	if options.GetPassword() == "" {
+		return options
+	}
+	public := pbuf.Clone(options).(*proto_lobby.RoomOptions)
+	public.Password = nil
+	return public
+}
+
+// sameState returns true if both snapshots describe the same state of the
+// room regardless of their version.
+func (s *roomSnapshot) sameState(o *roomSnapshot) bool {
+	if s.name != o.name || s.options != o.options || s.maxPlayers != o.maxPlayers ||
+		s.owner != o.owner || s.status != o.status || !s.readyDeadline.Equal(o.readyDeadline) ||
+		!sameUsers(s.joinOrder, o.joinOrder) ||
+		!sameUsers(s.ready, o.ready) || !sameUsers(s.notReady, o.notReady) ||
+		len(s.states) != len(o.states) {
+		return false
+	}
+	for userId, state := range s.states {
+		if o.states[userId] != state {
+			return false
+		}
+	}
+	return true
+}
+
+func sameUsers(a, b []user.Id) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// load returns the last published snapshot of the room.
+func (r *Room) load() *roomSnapshot {
+	return r.snapshot.Load().(*roomSnapshot)
+}
+
 // GetId returns a unique identifier for the room.
 func (r *Room) GetId() RoomId {
 	return r.id
@@ -72,12 +323,12 @@ func (r *Room) GetId() RoomId {
 
 // IsInProgress returns true if the game in the room is in progress.
 func (r *Room) IsInProgress() bool {
-	return r.status == inProgress
+	return r.load().status == inProgress
 }
 
 // IsStarting return true is the game in the room is starting.
 func (r *Room) IsStarting() bool {
-	return r.status == starting
+	return r.load().status == starting
 }
 
 // IsStarted return true if the room game is in progress or is in the process
@@ -92,13 +343,16 @@ func (r *Room) IsStarted() bool {
 // User can join the room regardless of the room's current status. If the player
 // ready process is in progress joined user is automatically considered ready.
 func (r *Room) Join(userId user.Id) error {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	if r.numPlayers() == r.maxPlayers {
-		return fmt.Errorf("Room is full (maxPlayers=%d)", r.maxPlayers)
-	}
-	r.players[userId] = util.RandomToken(stateLength)
-	return nil
+	return r.do(func() error {
+		if r.numPlayers() == r.maxPlayers {
+			return fmt.Errorf("Room is full (maxPlayers=%d)", r.maxPlayers)
+		}
+		if _, ok := r.players[userId]; !ok && userId != r.owner {
+			r.joinOrder = append(r.joinOrder, userId)
+		}
+		r.players[userId] = util.RandomToken(stateLength)
+		return nil
+	})
 }
 
 // ErrGameStartInProgress is returned by Leave if the user tries to leave the
@@ -111,23 +365,59 @@ var ErrGameStartInProgress = errors.New("Game start in progress")
 // If the game start is in progress the user that is part of the player ready process
 // can't leave the room untill the process is not complete.
 func (r *Room) Leave(userId user.Id) (bool, error) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	if r.ready != nil && r.ready.HasUser(userId) {
-		return true, ErrGameStartInProgress
-	}
-	if r.numPlayers() == 1 {
-		r.owner = ""
-		return false, nil
-	}
-	// If the user leaving is the owner we choose a new one.
-	if r.owner == userId {
-		r.owner = takeOne(r.players)
-		delete(r.players, r.owner)
-	} else {
+	notEmpty := true
+	err := r.do(func() error {
+		if r.ready != nil && r.ready.HasUser(userId) {
+			return ErrGameStartInProgress
+		}
+		r.removeFromJoinOrder(userId)
+		if r.numPlayers() == 1 {
+			r.owner = ""
+			notEmpty = false
+			return nil
+		}
+		// If the user leaving is the owner we choose a new one.
+		if r.owner == userId {
+			r.owner = takeOne(r.players)
+			delete(r.players, r.owner)
+		} else {
+			delete(r.players, userId)
+		}
+		return nil
+	})
+	return notEmpty, err
+}
+
+// TransferOwnership makes the player the owner of the room, the old owner
+// stays in the room as a player. The owner can't change while the ready check
+// is in progress.
+func (r *Room) TransferOwnership(userId user.Id) error {
+	return r.do(func() error {
+		if userId == r.owner {
+			return nil
+		}
+		if _, ok := r.players[userId]; !ok {
+			return ErrPlayerNotInRoom
+		}
+		if r.status == starting {
+			return ErrGameStartInProgress
+		}
 		delete(r.players, userId)
+		r.players[r.owner] = util.RandomToken(stateLength)
+		r.owner = userId
+		return nil
+	})
+}
+
+// removeFromJoinOrder removes the user from the join order.
+// This method should only be called by the room's goroutine.
+func (r *Room) removeFromJoinOrder(userId user.Id) {
+	for i, id := range r.joinOrder {
+		if id == userId {
+			r.joinOrder = append(r.joinOrder[:i], r.joinOrder[i+1:]...)
+			return
+		}
 	}
-	return true, nil
 }
 
 // takeOne takes one key from the input map and returns it.
@@ -142,43 +432,53 @@ func takeOne(m map[user.Id]string) user.Id {
 
 // Getowner return the current room owner user id.
 func (r *Room) GetOwner() user.Id {
-	return r.owner
+	return r.load().owner
 }
 
 // GetUserIds returns user ids of all the players currently in the room.
 func (r *Room) GetUserIds() []user.Id {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	result := r.getNonOwnerUserIdsHelper()
-	result = append(result, r.owner)
-	return result
+	s := r.load()
+	result := make([]user.Id, 0, 1+len(s.players))
+	result = append(result, s.players...)
+	return append(result, s.owner)
 }
 
 // GetNonOwnerUserIds returns user ids of all the players currently in the room
 // except the owner.
 func (r *Room) GetNonOwnerUserIds() []user.Id {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	return r.getNonOwnerUserIdsHelper()
-}
-
-// getNonOwnerUserIdshelper is a helper function that returns user ids of all
-// players currently in the room except the owner without claiming any locks.
-func (r *Room) getNonOwnerUserIdsHelper() []user.Id {
-	// A little optimization because we use this method in GetUserIds so we
-	// don't have to reallocate.
-	result := make([]user.Id, 0, 1+len(r.players))
-	for userId, _ := range r.players {
-		result = append(result, userId)
-	}
-	return result
+	return append([]user.Id(nil), r.load().players...)
 }
 
 // NumPlayers return the current number of players in the room.
 func (r *Room) NumPlayers() uint {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	return r.numPlayers()
+	return uint(1 + len(r.load().players))
+}
+
+// MaxPlayers returns the number of players the room has room for.
+func (r *Room) MaxPlayers() uint {
+	return r.load().maxPlayers
+}
+
+// IsPrivate returns true if the room is not listed, players join it with its
+// id.
+func (r *Room) IsPrivate() bool {
+	return r.load().options.GetPrivate()
+}
+
+// CheckPassword returns true if the password is the room's password or the
+// room has none.
+func (r *Room) CheckPassword(password string) bool {
+	expected := r.load().options.GetPassword()
+	return expected == "" || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+// SetReadyPolicy replaces the ready policy selected by the room's options.
+// It applies from the next ready check.
+func (r *Room) SetReadyPolicy(policy ReadyPolicy) {
+	r.do(func() error {
+		r.readyPolicy = policy
+		return nil
+	})
 }
 
 func (r *Room) numPlayers() uint {
@@ -187,17 +487,61 @@ func (r *Room) numPlayers() uint {
 
 // Proto converts a Room internal representation to a Protobuf representation
 // suitable for sending as a service response.
-// TODO: needs testing
+// The same representation is shared by all the callers until the room
+// changes so it must not be modified.
 func (r *Room) Proto() *proto_lobby.Room {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	return &proto_lobby.Room{
-		Id:      pbuf.String(r.id.String()),
-		Name:    &r.name,
-		Options: r.options,
-		Owner:   pbuf.String(r.owner.String()),
-		Players: toStringSlice(r.getNonOwnerUserIdsHelper()),
+	return r.load().proto
+}
+
+// Version returns the version of the room. Versions of the rooms of a
+// RoomList come from one increasing sequence.
+func (r *Room) Version() uint64 {
+	return r.load().version
+}
+
+// PlayerStatus is the state of a room as seen by one of its players. It
+// contains everything a client needs to resume after reconnecting.
+type PlayerStatus struct {
+	Room       *proto_lobby.Room
+	Starting   bool
+	InProgress bool
+	// State is the player's state token sent with StartGameEvent. The owner
+	// has no state token.
+	State string
+	// Ready is true if the player confirmed the ready check in progress.
+	Ready bool
+	// Vote is the vote in progress in the room, if any.
+	Vote *proto_lobby.Vote
+}
+
+// PlayerStatus returns the state of the room as seen by the user. If the user
+// is not in the room false is returned.
+func (r *Room) PlayerStatus(userId user.Id) (PlayerStatus, bool) {
+	s := r.load()
+	state, ok := s.states[userId]
+	if !ok && userId != s.owner {
+		return PlayerStatus{}, false
+	}
+	status := PlayerStatus{
+		Room:       s.proto,
+		Starting:   s.status == starting,
+		InProgress: s.status == inProgress,
+		State:      state,
+	}
+	if s.status == starting {
+		// Players that joined during the ready check don't need to confirm.
+		status.Ready = !containsUser(s.notReady, userId)
+	}
+	return status, true
+}
+
+func containsUser(userIds []user.Id, userId user.Id) bool {
+	for _, id := range userIds {
+		if id == userId {
+			return true
+		}
 	}
+	return false
 }
 
 func toStringSlice(ids []user.Id) []string {
@@ -217,24 +561,49 @@ var ErrAlreadyStarted = errors.New("Room game already started.")
 // A map of random states for every user is returned that should be sent to
 // the matching users so they can confirm they are ready.
 func (r *Room) StartGame() (map[user.Id]string, error) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	if r.status != notStarted {
-		return nil, ErrAlreadyStarted
-	}
-	if r.numPlayers() == 1 {
-		r.finishStartGame()
-	} else {
-		r.ready = NewPlayersReady(r.owner, copyMap(r.players), func() {
-			// Lock needed for this method is claimed in PlayerReady.
+	var states map[user.Id]string
+	err := r.do(func() error {
+		if r.status != notStarted {
+			return ErrAlreadyStarted
+		}
+		if r.numPlayers() == 1 {
 			r.finishStartGame()
-		})
-		r.ready.Start(r.ReadyTimeout, func(timeoutId string) {
-			r.resetRoomStatus(timeoutId)
-		})
-		r.status = starting
-	}
-	return copyMap(r.players), nil
+		} else {
+			// The game is started in PlayerReady once the process is complete.
+			r.ready = NewPlayersReadyWithPolicy(r.owner, copyMap(r.players), r.readyPolicy, nil)
+			r.ready.Clock = r.Clock
+			r.ready.Start(r.ReadyTimeout, func(timeoutId string) {
+				r.resetRoomStatus(timeoutId)
+			})
+			r.status = starting
+			r.pending.readyCheck = append(r.pending.readyCheck, ReadyCheckChange{
+				Status:   ReadyCheckStarted,
+				Deadline: r.ready.Deadline(),
+			})
+		}
+		states = copyMap(r.players)
+		return nil
+	})
+	return states, err
+}
+
+// ErrForceStartNotAllowed is returned by ForceStart if the room's ready policy
+// does not allow starting the game before it is satisfied.
+var ErrForceStartNotAllowed = errors.New("Ready policy does not allow forcing the start.")
+
+// ForceStart starts the game without waiting for the remaining players to
+// confirm they are ready. Players that did not confirm are removed.
+func (r *Room) ForceStart() error {
+	return r.do(func() error {
+		if r.status != starting {
+			return ErrNotStarting
+		}
+		if !r.ready.CanForce() {
+			return ErrForceStartNotAllowed
+		}
+		r.startWithReadyPlayers()
+		return nil
+	})
 }
 
 // ErrNotStarted is returned by CancelStart if the game is not in the process of starting.
@@ -242,50 +611,110 @@ var ErrNotStarting = errors.New("Room game not starting.")
 
 // CancelStart cancels the start of the game and resets the room's status.
 func (r *Room) CancelStart() error {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	if r.status != starting {
-		return ErrNotStarting
-	}
-	r.reset()
-	return nil
+	return r.do(func() error {
+		if r.status != starting {
+			return ErrNotStarting
+		}
+		r.reset()
+		r.pending.readyCheck = append(r.pending.readyCheck, ReadyCheckChange{
+			Status: ReadyCheckCancelled,
+		})
+		return nil
+	})
 }
 
 // ErrUnexpectedReady is returned by PlayerReady if room status is not starting.
 var ErrUnexpectedReady = errors.New("Unexpected ready.")
 
 // PlayerReady marks the user with given id and state as ready.
+// If this satisfies the room's ready policy the game is started.
 func (r *Room) PlayerReady(userId user.Id, state string) error {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	if r.status != starting {
-		return ErrUnexpectedReady
+	return r.do(func() error {
+		if r.status != starting {
+			return ErrUnexpectedReady
+		}
+		if err := r.ready.Ready(userId, state); err != nil {
+			return err
+		}
+		r.pending.readyCheck = append(r.pending.readyCheck, ReadyCheckChange{
+			Status: ReadyCheckProgress,
+			Users:  r.ready.ReadyUsers(),
+		})
+		if r.ready.IsComplete() {
+			r.startWithReadyPlayers()
+		}
+		return nil
+	})
+}
+
+// startWithReadyPlayers removes the players that did not confirm they are
+// ready and starts the game.
+// This method should only be called by the room's goroutine.
+func (r *Room) startWithReadyPlayers() {
+	dropped := r.ready.NotReady()
+	for _, userId := range dropped {
+		delete(r.players, userId)
+		r.removeFromJoinOrder(userId)
+	}
+	r.pending.dropped = append(r.pending.dropped, dropped...)
+	r.ready.Cancel()
+	r.ready = nil
+	r.finishStartGame()
+}
+
+// notify delivers the notifications collected by a command to the room's
+// callbacks.
+func (r *Room) notify(pending roomNotifications) {
+	if r.ReadyCheckChanged != nil {
+		for _, change := range pending.readyCheck {
+			r.ReadyCheckChanged(r, change)
+		}
+	}
+	if len(pending.dropped) > 0 && r.PlayersDropped != nil {
+		r.PlayersDropped(r, pending.dropped)
 	}
-	return r.ready.Ready(userId, state)
 }
 
 // finishStartGame starts the game and updates the room's status.
-// This method should only be called if lock to this room is currently owned.
+// This method should only be called by the room's goroutine.
 // TODO: game should be started
 func (r *Room) finishStartGame() {
 	r.status = inProgress
 	log.Printf("All players in room [id=%s] are ready, starting game.", r.id)
 }
 
-// resetRoomSttaus resets the room status to it's initial values.
+// resetRoomSttaus resets the room status to it's initial values and reports
+// the ready check as failed, unless the ready policy starts the game without
+// the players that are not ready when the timeout ends.
 // New random player state is generated so outdated PlayerReady requests are
 // rejected.
 // Timeout id must match the id of the user ready process helper, if it does not
 // nothing happens.
 func (r *Room) resetRoomStatus(timeoutId string) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-	if r.ready != nil && r.ready.GetId() == timeoutId {
-		r.reset()
+	if r.ListLock != nil {
+		r.ListLock.Lock()
+		defer r.ListLock.Unlock()
 	}
+	r.do(func() error {
+		if r.ready == nil || r.ready.GetId() != timeoutId {
+			return nil
+		}
+		if r.ready.StartOnTimeout() {
+			r.startWithReadyPlayers()
+			return nil
+		}
+		r.pending.readyCheck = append(r.pending.readyCheck, ReadyCheckChange{
+			Status: ReadyCheckFailed,
+			Users:  r.ready.NotReady(),
+		})
+		log.Printf("Ready check in room [id=%s] timed out.", r.id)
+		r.reset()
+		return nil
+	})
 }
 
-// reset resets room's status without claiming any locks.
+// reset resets room's status.
+// This method should only be called by the room's goroutine.
 func (r *Room) reset() {
 	r.status = notStarted
 	r.ready.Cancel()
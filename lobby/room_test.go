@@ -8,6 +8,7 @@ import (
 
 	"github.com/opentarock/service-api/go/user"
 	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
 )
 
 const ownerId = user.Id("1")
@@ -16,6 +17,15 @@ func makeRoom() *lobby.Room {
 	return lobby.NewRoom("name", ownerId, 3)
 }
 
+// makeRoomWithClock returns a room measuring the ready timeout with a fake
+// clock.
+func makeRoomWithClock() (*lobby.Room, *util.FakeClock) {
+	room := makeRoom()
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	room.Clock = clock
+	return room, clock
+}
+
 func TestRoomIdIsGenerated(t *testing.T) {
 	room1 := makeRoom()
 	room2 := makeRoom()
@@ -184,21 +194,19 @@ func TestGameIsStartedWhenAllPlayersAreReady(t *testing.T) {
 }
 
 func TestGameStatusIsResetAfterPlayerReadyTImeout(t *testing.T) {
-	room := makeRoom()
-	room.ReadyTimeout = 100 * time.Millisecond
+	room, clock := makeRoomWithClock()
 	room.Join("2")
 	room.StartGame()
 	assert.True(t, room.IsStarting(), "After start room status should be starting")
-	time.Sleep(200 * time.Millisecond)
+	clock.Advance(room.ReadyTimeout)
 	assert.True(t, !room.IsStarted(), "After timeout room status should be back to notStarted")
 }
 
 func TestUserStateIsRegeneratedOnTimeout(t *testing.T) {
-	room := makeRoom()
-	room.ReadyTimeout = 100 * time.Millisecond
+	room, clock := makeRoomWithClock()
 	room.Join("2")
 	playerState, _ := room.StartGame()
-	time.Sleep(200 * time.Millisecond)
+	clock.Advance(room.ReadyTimeout)
 	playerState2, _ := room.StartGame()
 	defer room.CancelStart()
 	assert.NotEqual(t, playerState["2"], playerState2["2"], "State should be regenerated")
@@ -218,3 +226,192 @@ func TestGameWithOnlyOnePLayerIsAutomaticallyStarted(t *testing.T) {
 	assert.Equal(t, len(playerState), 0)
 	assert.True(t, room.IsInProgress(), "Game should be automatically started")
 }
+
+func TestQuorumPolicyStartsGameAndDropsPlayersNotReady(t *testing.T) {
+	room := lobby.NewRoom("name", ownerId, 4)
+	room.SetReadyPolicy(lobby.QuorumReady(2))
+	var dropped []user.Id
+	room.PlayersDropped = func(r *lobby.Room, userIds []user.Id) {
+		dropped = userIds
+	}
+	room.Join("2")
+	room.Join("3")
+	playerState, _ := room.StartGame()
+
+	err := room.PlayerReady("2", playerState["2"])
+	assert.Nil(t, err)
+	assert.True(t, room.IsInProgress())
+	assert.Equal(t, []user.Id{"3"}, dropped)
+	assert.NotContains(t, room.GetUserIds(), user.Id("3"))
+	assert.Equal(t, 2, room.NumPlayers())
+}
+
+func TestDropNotReadyPolicyStartsGameOnTimeout(t *testing.T) {
+	room, clock := makeRoomWithClock()
+	room.SetReadyPolicy(lobby.DropNotReadyOnTimeout())
+	var dropped []user.Id
+	room.PlayersDropped = func(r *lobby.Room, userIds []user.Id) {
+		dropped = userIds
+	}
+	room.Join("2")
+	room.Join("3")
+	playerState, _ := room.StartGame()
+	room.PlayerReady("2", playerState["2"])
+
+	clock.Advance(room.ReadyTimeout - time.Millisecond)
+	assert.True(t, room.IsStarting(), "Players can confirm until the timeout")
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, []user.Id{"3"}, dropped, "Players not ready should be dropped on timeout")
+	assert.True(t, room.IsInProgress(), "Game is started without players that are not ready")
+	assert.Equal(t, 2, room.NumPlayers())
+}
+
+func TestOwnerCanForceStartIfPolicyAllows(t *testing.T) {
+	room := makeRoom()
+	room.SetReadyPolicy(lobby.OwnerForceStart())
+	room.Join("2")
+	room.Join("3")
+	playerState, _ := room.StartGame()
+	room.PlayerReady("2", playerState["2"])
+
+	err := room.ForceStart()
+	assert.Nil(t, err)
+	assert.True(t, room.IsInProgress())
+	assert.NotContains(t, room.GetUserIds(), user.Id("3"))
+}
+
+func TestForceStartIsRejectedByDefaultPolicy(t *testing.T) {
+	room := makeRoom()
+	room.Join("2")
+	room.StartGame()
+	defer room.CancelStart()
+
+	err := room.ForceStart()
+	assert.Equal(t, lobby.ErrForceStartNotAllowed, err)
+	assert.True(t, room.IsStarting())
+}
+
+func TestForceStartRequiresGameStarting(t *testing.T) {
+	room := makeRoom()
+	room.SetReadyPolicy(lobby.OwnerForceStart())
+	err := room.ForceStart()
+	assert.Equal(t, lobby.ErrNotStarting, err)
+}
+
+func TestReadyCheckStartReportsDeadline(t *testing.T) {
+	room, clock := makeRoomWithClock()
+	room.ReadyTimeout = time.Minute
+	var changes []lobby.ReadyCheckChange
+	room.ReadyCheckChanged = func(r *lobby.Room, change lobby.ReadyCheckChange) {
+		changes = append(changes, change)
+	}
+	room.Join("2")
+	room.StartGame()
+	defer room.CancelStart()
+
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, lobby.ReadyCheckStarted, changes[0].Status)
+	assert.Equal(t, clock.Now().Add(time.Minute), changes[0].Deadline)
+}
+
+func TestReadyCheckProgressListsReadyPlayers(t *testing.T) {
+	room := makeRoom()
+	var changes []lobby.ReadyCheckChange
+	room.ReadyCheckChanged = func(r *lobby.Room, change lobby.ReadyCheckChange) {
+		changes = append(changes, change)
+	}
+	room.Join("2")
+	room.Join("3")
+	playerState, _ := room.StartGame()
+	defer room.CancelStart()
+	room.PlayerReady("2", playerState["2"])
+
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, lobby.ReadyCheckProgress, changes[1].Status)
+	assert.Contains(t, changes[1].Users, ownerId)
+	assert.Contains(t, changes[1].Users, user.Id("2"))
+	assert.NotContains(t, changes[1].Users, user.Id("3"))
+}
+
+func TestReadyCheckCancelIsReported(t *testing.T) {
+	room := makeRoom()
+	var changes []lobby.ReadyCheckChange
+	room.ReadyCheckChanged = func(r *lobby.Room, change lobby.ReadyCheckChange) {
+		changes = append(changes, change)
+	}
+	room.Join("2")
+	room.StartGame()
+	room.CancelStart()
+
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, lobby.ReadyCheckCancelled, changes[1].Status)
+}
+
+func TestReadyCheckTimeoutReportsPlayersNotReady(t *testing.T) {
+	room, clock := makeRoomWithClock()
+	var failed []lobby.ReadyCheckChange
+	room.ReadyCheckChanged = func(r *lobby.Room, change lobby.ReadyCheckChange) {
+		if change.Status == lobby.ReadyCheckFailed {
+			failed = append(failed, change)
+		}
+	}
+	room.Join("2")
+	room.Join("3")
+	playerState, _ := room.StartGame()
+	room.PlayerReady("2", playerState["2"])
+
+	clock.Advance(room.ReadyTimeout)
+	assert.Equal(t, 1, len(failed), "Ready check should fail on timeout")
+	assert.Equal(t, []user.Id{"3"}, failed[0].Users)
+	assert.False(t, room.IsStarting())
+}
+
+func TestClosedRoomRejectsChanges(t *testing.T) {
+	room := makeRoom()
+	room.Join("2")
+	room.Close()
+
+	assert.Equal(t, lobby.ErrRoomClosed, room.Join("3"))
+	_, err := room.StartGame()
+	assert.Equal(t, lobby.ErrRoomClosed, err)
+	assert.Equal(t, 2, room.NumPlayers(), "Closed room can still be read")
+}
+
+func TestCallbacksCanReadRoom(t *testing.T) {
+	room, clock := makeRoomWithClock()
+	room.SetReadyPolicy(lobby.DropNotReadyOnTimeout())
+	var remaining []user.Id
+	room.PlayersDropped = func(r *lobby.Room, userIds []user.Id) {
+		remaining = r.GetUserIds()
+	}
+	room.Join("2")
+	room.Join("3")
+	playerState, _ := room.StartGame()
+	room.PlayerReady("2", playerState["2"])
+
+	clock.Advance(room.ReadyTimeout)
+	assert.Len(t, remaining, 2, "Callbacks see the state after the change")
+	assert.NotContains(t, remaining, user.Id("3"))
+}
+
+func TestProtoListsPlayersInJoinOrder(t *testing.T) {
+	room := lobby.NewRoom("name", ownerId, 4)
+	room.Join("3")
+	room.Join("2")
+	room.Join("4")
+	assert.Equal(t, []string{"3", "2", "4"}, room.Proto().GetPlayers())
+}
+
+func TestRoomVersionOnlyChangesWithRoom(t *testing.T) {
+	room := makeRoom()
+	version := room.Version()
+	proto := room.Proto()
+
+	room.CancelStart()
+	assert.Equal(t, version, room.Version(), "Failed change keeps the version")
+	assert.True(t, proto == room.Proto(), "Unchanged room shares its representation")
+
+	room.Join("2")
+	assert.True(t, room.Version() > version)
+	assert.Equal(t, room.Version(), room.Proto().GetVersion())
+}
@@ -0,0 +1,169 @@
+package lobby
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+)
+
+var (
+	ErrMessageEmpty   = errors.New("Chat message is empty")
+	ErrMessageTooLong = errors.New("Chat message is too long")
+	// ErrMessageRejected is returned if the moderation hook did not allow
+	// the message.
+	ErrMessageRejected = errors.New("Chat message rejected")
+	ErrMuted           = errors.New("User is muted in the room")
+	// ErrPlayerNotInRoom is returned by MuteMember if the member to mute is
+	// not in the room.
+	ErrPlayerNotInRoom = errors.New("Player is not in the room")
+	// ErrMuteSelf is returned by MuteMember if users try to mute themselves.
+	ErrMuteSelf = errors.New("Users can't mute themselves")
+)
+
+// roomChat is the chat of a room. It is kept by the RoomList apart from the
+// room itself so chatting does not change the room's version.
+type roomChat struct {
+	// history are the most recent messages, oldest first.
+	history []*proto_lobby.ChatMessage
+	muted   map[user.Id]bool
+}
+
+// chat returns the chat of the room, creating it if the room has none yet.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) chat(roomId RoomId) *roomChat {
+	chat := r.chats[roomId]
+	if chat == nil {
+		chat = &roomChat{muted: make(map[user.Id]bool)}
+		r.chats[roomId] = chat
+	}
+	return chat
+}
+
+// cleanMessage drops control characters other than new lines and invalid
+// characters from the message and trims it. It returns an error if the
+// result is empty or longer than maxLength characters.
+func cleanMessage(text string, maxLength uint) (string, error) {
+	if uint(len(text)) > maxLength*utf8.UTFMax {
+		return "", ErrMessageTooLong
+	}
+	text = strings.TrimSpace(strings.Map(func(c rune) rune {
+		if (unicode.IsControl(c) && c != '\n') || c == utf8.RuneError {
+			return -1
+		}
+		return c
+	}, text))
+	if text == "" {
+		return "", ErrMessageEmpty
+	}
+	if uint(utf8.RuneCountInString(text)) > maxLength {
+		return "", ErrMessageTooLong
+	}
+	return text, nil
+}
+
+// SendRoomMessage sends a chat message from the user to everyone in their
+// room and adds it to the room's chat history, players joining later get the
+// last ChatHistory messages. Messages are trimmed and must not be empty or
+// longer than MaxMessageLength characters. If ModerateMessage is set it can
+// change or reject the message.
+func (r *RoomList) SendRoomMessage(userId user.Id, text string) (*proto_lobby.ChatMessage, error) {
+	limits := r.GetLimits()
+	text, err := cleanMessage(text, limits.MaxMessageLength)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[r.players[userId]]
+	if room == nil {
+		return nil, ErrNotInRoom
+	}
+	chat := r.chat(room.GetId())
+	if chat.muted[userId] {
+		return nil, ErrMuted
+	}
+	if r.ModerateMessage != nil {
+		var ok bool
+		if text, ok = r.ModerateMessage(userId, room.GetId(), text); !ok {
+			log.Printf("Message from user [id=%s] in room [id=%s] was rejected", userId, room.GetId())
+			return nil, ErrMessageRejected
+		}
+		// The moderated text must follow the same rules.
+		if text, err = cleanMessage(text, limits.MaxMessageLength); err != nil {
+			return nil, err
+		}
+	}
+	msg := &proto_lobby.ChatMessage{
+		Sender: pbuf.String(userId.String()),
+		Text:   pbuf.String(text),
+		SentAt: pbuf.Int64(r.scheduler.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	chat.history = append(chat.history, msg)
+	if uint(len(chat.history)) > limits.ChatHistory {
+		chat.history = chat.history[uint(len(chat.history))-limits.ChatHistory:]
+	}
+	r.touchRoom(room)
+	r.notifyAsync(&proto_lobby.RoomMessageEvent{
+		RoomId:  pbuf.String(room.GetId().String()),
+		Message: msg,
+	}, room.GetUserIds()...)
+	return msg, nil
+}
+
+// sendChatHistory sends the chat history of the room to a user that just
+// joined it.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) sendChatHistory(room *Room, userId user.Id) {
+	chat := r.chats[room.GetId()]
+	if chat == nil || len(chat.history) == 0 {
+		return
+	}
+	r.notifyAsync(&proto_lobby.RoomChatHistoryEvent{
+		RoomId:   pbuf.String(room.GetId().String()),
+		Messages: append([]*proto_lobby.ChatMessage(nil), chat.history...),
+	}, userId)
+}
+
+// MuteMember mutes or unmutes a member of the room, muted members can't send
+// chat messages. Only the owner and users that manage rooms can mute members. Members stay
+// muted if they leave and join the room again.
+func (r *RoomList) MuteMember(userId user.Id, roomId RoomId, memberId user.Id, muted bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room, err := r.managedRoom(userId, roomId, AnyVersion)
+	if err != nil {
+		return err
+	}
+	if memberId == userId {
+		return ErrMuteSelf
+	}
+	if r.players[memberId] != room.GetId() {
+		return ErrPlayerNotInRoom
+	}
+	chat := r.chat(room.GetId())
+	if chat.muted[memberId] == muted {
+		return nil
+	}
+	if muted {
+		chat.muted[memberId] = true
+		log.Printf("User [id=%s] muted user [id=%s] in room [id=%s]", userId, memberId, room.GetId())
+	} else {
+		delete(chat.muted, memberId)
+		log.Printf("User [id=%s] unmuted user [id=%s] in room [id=%s]", userId, memberId, room.GetId())
+	}
+	r.notifyAsync(&proto_lobby.PlayerMutedEvent{
+		RoomId: pbuf.String(room.GetId().String()),
+		Player: pbuf.String(memberId.String()),
+		Muted:  pbuf.Bool(muted),
+	}, room.GetUserIds()...)
+	return nil
+}
@@ -0,0 +1,151 @@
+package lobby_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// lastEvent returns the last event of the type or nil if there is none.
+func lastEvent(events []proto.ProtobufMessage, msgType proto.Type) proto.ProtobufMessage {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].GetMessageType() == msgType {
+			return events[i]
+		}
+	}
+	return nil
+}
+
+// notifications is a notify client sending the users of the chat messages
+// to a channel.
+type notifications chan []user.Id
+
+func (n notifications) MessageUsers(msg proto.ProtobufMessage, users ...user.Id) (interface{}, error) {
+	if msg.GetMessageType() == proto_lobby.RoomMessageEventMessage {
+		n <- users
+	}
+	return nil, nil
+}
+
+func (n notifications) Close() error {
+	return nil
+}
+
+func TestRoomMessageIsSentThroughNotifyClient(t *testing.T) {
+	sent := make(notifications, 1)
+	roomList := lobby.NewRoomList(sent)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	roomList.SendRoomMessage("2", "hello")
+	select {
+	case users := <-sent:
+		assert.Len(t, users, 2)
+		assert.Contains(t, users, user.Id("1"))
+		assert.Contains(t, users, user.Id("2"))
+	case <-time.After(time.Second):
+		t.Fatal("Message was not sent")
+	}
+}
+
+func TestRoomMessageIsSentToMembers(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	msg, err := roomList.SendRoomMessage("2", "  hello\x07 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", msg.GetText())
+	assert.Equal(t, "2", msg.GetSender())
+	event := lastEvent(events(), proto_lobby.RoomMessageEventMessage)
+	if assert.NotNil(t, event) {
+		assert.Equal(t, msg, event.(*proto_lobby.RoomMessageEvent).GetMessage())
+	}
+
+	_, err = roomList.SendRoomMessage("3", "hello")
+	assert.Equal(t, lobby.ErrNotInRoom, err)
+	_, err = roomList.SendRoomMessage("2", " \n ")
+	assert.Equal(t, lobby.ErrMessageEmpty, err)
+	_, err = roomList.SendRoomMessage("2", strings.Repeat("a", int(roomList.GetLimits().MaxMessageLength)+1))
+	assert.Equal(t, lobby.ErrMessageTooLong, err)
+}
+
+func TestLateJoinerGetsChatHistory(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	limits := roomList.GetLimits()
+	limits.ChatHistory = 2
+	roomList.SetLimits(limits)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	for _, text := range []string{"one", "two", "three"} {
+		roomList.SendRoomMessage("1", text)
+	}
+
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	event := lastEvent(events(), proto_lobby.RoomChatHistoryEventMessage)
+	if assert.NotNil(t, event) {
+		messages := event.(*proto_lobby.RoomChatHistoryEvent).GetMessages()
+		if assert.Len(t, messages, 2) {
+			assert.Equal(t, "two", messages[0].GetText())
+			assert.Equal(t, "three", messages[1].GetText())
+		}
+	}
+}
+
+func TestOwnerCanMuteMember(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	assert.NoError(t, roomList.MuteMember("1", lobby.OwnRoom, "2", true))
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.PlayerMutedEventMessage))
+	_, err := roomList.SendRoomMessage("2", "hello")
+	assert.Equal(t, lobby.ErrMuted, err)
+
+	assert.Equal(t, lobby.ErrNotOwner, roomList.MuteMember("2", lobby.OwnRoom, "1", true))
+	assert.Equal(t, lobby.ErrPlayerNotInRoom, roomList.MuteMember("1", lobby.OwnRoom, "3", true))
+	assert.Equal(t, lobby.ErrMuteSelf, roomList.MuteMember("1", lobby.OwnRoom, "1", true))
+
+	assert.NoError(t, roomList.MuteMember("1", lobby.OwnRoom, "2", false))
+	_, err = roomList.SendRoomMessage("2", "hello")
+	assert.NoError(t, err)
+}
+
+func TestModerateMessage(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	roomList.ModerateMessage = func(userId user.Id, roomId lobby.RoomId, text string) (string, bool) {
+		return strings.Replace(text, "darn", "****", -1), !strings.Contains(text, "spam")
+	}
+	roomList.CreateRoom("1", "room", nil)
+
+	msg, err := roomList.SendRoomMessage("1", "darn it")
+	assert.NoError(t, err)
+	assert.Equal(t, "**** it", msg.GetText())
+	_, err = roomList.SendRoomMessage("1", "buy spam")
+	assert.Equal(t, lobby.ErrMessageRejected, err)
+}
+
+func TestModeratedMessageIsChecked(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	roomList.ModerateMessage = func(userId user.Id, roomId lobby.RoomId, text string) (string, bool) {
+		if text == "long" {
+			return strings.Repeat("x", 1000), true
+		}
+		return strings.Replace(text, "darn", " ", -1), true
+	}
+	roomList.CreateRoom("1", "room", nil)
+
+	_, err := roomList.SendRoomMessage("1", "darn")
+	assert.Equal(t, lobby.ErrMessageEmpty, err)
+	_, err = roomList.SendRoomMessage("1", "long")
+	assert.Equal(t, lobby.ErrMessageTooLong, err)
+	msg, err := roomList.SendRoomMessage("1", "oh darn")
+	assert.NoError(t, err)
+	assert.Equal(t, "oh", msg.GetText())
+}
@@ -0,0 +1,130 @@
+package lobby
+
+import (
+	"log"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// roomIdle is the pending idle timeout of a room. The task first warns the
+// players and then schedules the closing of the room.
+type roomIdle struct {
+	task    *util.ScheduledTask
+	closing bool
+}
+
+// touchRoom records activity in a room and restarts its idle timeout.
+// The timeout depends on the room's status, rooms with a game in progress
+// use InProgressIdleTtl.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) touchRoom(room *Room) {
+	if r.rooms[room.GetId()] != room {
+		return
+	}
+	limits := r.GetLimits()
+	ttl := limits.IdleTtl
+	if room.IsInProgress() {
+		ttl = limits.InProgressIdleTtl
+	}
+	idle := r.idle[room.GetId()]
+	if ttl == 0 {
+		if idle != nil {
+			idle.task.Stop()
+			delete(r.idle, room.GetId())
+		}
+		return
+	}
+	warning := limits.IdleWarning
+	if warning > ttl {
+		warning = ttl
+	}
+	if idle != nil && !idle.closing && idle.task.Reschedule(ttl-warning) {
+		return
+	}
+	if idle != nil {
+		idle.task.Stop()
+	}
+	idle = &roomIdle{}
+	idle.task = r.scheduler.Schedule(ttl-warning, func() {
+		r.idleWarning(room, idle, warning)
+	})
+	r.idle[room.GetId()] = idle
+}
+
+// stopIdle stops the idle timeout of a room that was removed.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) stopIdle(roomId RoomId) {
+	if idle := r.idle[roomId]; idle != nil {
+		idle.task.Stop()
+		delete(r.idle, roomId)
+	}
+}
+
+// idleWarning warns the players that the room will be closed after
+// duration warning unless there is some activity in the meantime.
+func (r *RoomList) idleWarning(room *Room, idle *roomIdle, warning time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.idle[room.GetId()] != idle || r.rooms[room.GetId()] != room {
+		// The room was touched or removed while the warning was being fired.
+		return
+	}
+	idle.closing = true
+	idle.task = r.scheduler.Schedule(warning, func() {
+		r.idleClose(room, idle)
+	})
+
+	closesAt := r.scheduler.Now().Add(warning)
+	log.Printf("Room [id=%s] is idle and will be closed at %s", room.GetId(), closesAt)
+	r.notifyAsync(&proto_lobby.RoomIdleWarningEvent{
+		RoomId:   pbuf.String(room.GetId().String()),
+		ClosesAt: pbuf.Int64(closesAt.UnixNano() / int64(time.Millisecond)),
+	}, room.GetUserIds()...)
+}
+
+func (r *RoomList) idleClose(room *Room, idle *roomIdle) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.idle[room.GetId()] != idle {
+		return
+	}
+	log.Printf("Closing idle room [id=%s]", room.GetId())
+	r.closeRoom(room, proto_lobby.RoomClosedEvent_IDLE)
+}
+
+// closeRoom removes the room and all of its players from the list and
+// notifies them that the room was closed.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) closeRoom(room *Room, reason proto_lobby.RoomClosedEvent_Reason) {
+	roomId := room.GetId()
+	// A ready check still in progress must not fire for a removed room. It is
+	// cancelled while the room is still listed so its players are told about
+	// it before the room is gone.
+	room.CancelStart()
+	delete(r.rooms, roomId)
+	r.publishRooms()
+	r.stopIdle(roomId)
+	delete(r.chats, roomId)
+	delete(r.kicked, roomId)
+	r.stopVote(roomId)
+	room.Close()
+	userIds := room.GetUserIds()
+	for _, userId := range userIds {
+		if r.players[userId] == roomId {
+			delete(r.players, userId)
+		}
+	}
+	r.notifyAsync(&proto_lobby.RoomClosedEvent{
+		RoomId: pbuf.String(roomId.String()),
+		Reason: reason.Enum(),
+	}, userIds...)
+	if !room.IsPrivate() {
+		r.notifyAsync(&proto_lobby.RoomRemovedEvent{
+			RoomId: pbuf.String(roomId.String()),
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	pbuf "code.google.com/p/gogoprotobuf/proto"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/opentarock/service-api/go/proto"
 	"github.com/opentarock/service-api/go/proto_lobby"
 	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/util"
 )
 
 type RoomId string
@@ -23,22 +26,168 @@ type Rooms map[RoomId]*Room
 
 type Players map[user.Id]RoomId
 
+// Limits are the room list settings that can be changed while the service
+// is running. Changes only apply to rooms created afterwards, except for the
+// idle settings that apply from the next activity in a room and the chat and
+// vote settings that apply from the next message or vote.
+type Limits struct {
+	// MaxRooms is the maximum number of rooms, zero means there is no limit.
+	MaxRooms     uint
+	MaxPlayers   uint
+	ReadyTimeout time.Duration
+	// IdleTtl is how long a room without a game in progress can be idle
+	// before it is closed, zero means rooms are never closed.
+	IdleTtl time.Duration
+	// InProgressIdleTtl is the idle ttl of rooms with a game in progress.
+	InProgressIdleTtl time.Duration
+	// IdleWarning is how long before closing an idle room its players are
+	// warned.
+	IdleWarning time.Duration
+	// HeartbeatTimeout is how long after the last heartbeat a user that is
+	// not connected through a gateway is considered disconnected.
+	HeartbeatTimeout time.Duration
+	// DisconnectGrace is how long a disconnected user keeps their seat in a
+	// room.
+	DisconnectGrace time.Duration
+	// MaxNameLength is the maximum number of characters in a room name.
+	MaxNameLength uint
+	// MaxMessageLength is the maximum number of characters in a chat
+	// message.
+	MaxMessageLength uint
+	// ChatHistory is the number of chat messages a room keeps for players
+	// that join later.
+	ChatHistory uint
+	// VoteTimeout is how long the members of a room have to decide a vote.
+	VoteTimeout time.Duration
+	// VoteThreshold is the percentage of the voters that must vote yes for
+	// a vote to pass.
+	VoteThreshold uint
+	// KickCooldown is how long a player kicked by vote can't join the room
+	// again.
+	KickCooldown time.Duration
+}
+
+// DefaultLimits returns the limits used by a new RoomList.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxRooms:          0,
+		MaxPlayers:        4,
+		ReadyTimeout:      readyTimeout,
+		IdleTtl:           10 * time.Minute,
+		InProgressIdleTtl: 2 * time.Hour,
+		IdleWarning:       time.Minute,
+		HeartbeatTimeout:  30 * time.Second,
+		DisconnectGrace:   time.Minute,
+		MaxNameLength:     32,
+		MaxMessageLength:  500,
+		ChatHistory:       50,
+		VoteTimeout:       30 * time.Second,
+		VoteThreshold:     60,
+		KickCooldown:      5 * time.Minute,
+	}
+}
+
+// EventListener receives every event that is sent to users.
+// An empty list of users means the event is meant for everyone, for example
+// a change to the list of rooms.
+// Listeners are called synchronously in the order the events happened so they
+// must not block or call back into the RoomList.
+type EventListener func(msg proto.ProtobufMessage, users []user.Id)
+
+// RoomList keeps track of all the rooms and of the room every player is in.
+// Operations that change who is in which room hold the list's lock for the
+// whole change, including the change to the room itself, so the rooms and the
+// players never disagree. The room callbacks are always called while owning
+// the list's lock.
+// Listing the rooms does not take the lock, it uses the published copy of the
+// rooms and the snapshots of the rooms themselves.
 type RoomList struct {
-	rooms        Rooms
-	roomsLock    *sync.RWMutex
-	players      Players
-	playersLock  *sync.RWMutex
+	rooms   Rooms
+	players Players
+	// lock guards rooms, players, idle, chats, votes and kicked.
+	lock *sync.RWMutex
+	// published is a copy of rooms that is replaced whenever a room is added
+	// or removed. Rooms change far less often than they are listed.
+	published atomic.Value
+	// versions are shared by the list and its rooms.
+	versions      *versions
+	limits        Limits
+	limitsLock    *sync.RWMutex
+	listeners     []EventListener
+	listenersLock *sync.Mutex
+	// scheduler runs the timeouts of all the rooms.
+	scheduler *util.Scheduler
+	idle      map[RoomId]*roomIdle
+	chats     map[RoomId]*roomChat
+	votes     map[RoomId]*roomVote
+	// kicked are the players kicked from a room by vote with the time they
+	// can join it again.
+	kicked       map[RoomId]map[user.Id]time.Time
+	presence     map[user.Id]*presence
+	presenceLock *sync.Mutex
 	notifyClient client.NotifyClient
+	// ManagesRooms reports whether a user may perform owner actions, like
+	// starting the game, in rooms they do not own. If nil only the owners
+	// manage their rooms.
+	ManagesRooms func(userId user.Id) bool
+	// BlocksName reports whether a room name is not allowed, for example
+	// because it contains an offensive word. It is called with the normalized
+	// name. If nil only the built in checks apply.
+	BlocksName func(name string) bool
+	// ModerateMessage is called with every chat message before it is sent.
+	// It returns the text to send, which may be changed, and false if the
+	// message must not be sent at all. If nil all messages are sent.
+	// It is called while owning the list's lock so it must not block or call
+	// back into the RoomList.
+	ModerateMessage func(userId user.Id, roomId RoomId, text string) (string, bool)
 }
 
 func NewRoomList(notifyClient client.NotifyClient) *RoomList {
-	return &RoomList{
-		rooms:        make(Rooms),
-		roomsLock:    new(sync.RWMutex),
-		players:      make(Players),
-		playersLock:  new(sync.RWMutex),
-		notifyClient: notifyClient,
+	return NewRoomListWithClock(notifyClient, util.RealClock())
+}
+
+// NewRoomListWithClock returns a new RoomList with timeouts measured by clock.
+func NewRoomListWithClock(notifyClient client.NotifyClient, clock util.Clock) *RoomList {
+	r := &RoomList{
+		rooms:         make(Rooms),
+		players:       make(Players),
+		lock:          new(sync.RWMutex),
+		limits:        DefaultLimits(),
+		limitsLock:    new(sync.RWMutex),
+		listenersLock: new(sync.Mutex),
+		scheduler:     util.NewScheduler(clock),
+		idle:          make(map[RoomId]*roomIdle),
+		chats:         make(map[RoomId]*roomChat),
+		votes:         make(map[RoomId]*roomVote),
+		kicked:        make(map[RoomId]map[user.Id]time.Time),
+		presence:      make(map[user.Id]*presence),
+		presenceLock:  new(sync.Mutex),
+		notifyClient:  notifyClient,
+		versions:      newVersions(),
 	}
+	r.published.Store(make(Rooms))
+	return r
+}
+
+// AddEventListener registers a listener that receives all the events.
+func (r *RoomList) AddEventListener(l EventListener) {
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
+	r.listeners = append(r.listeners, l)
+}
+
+// SetLimits changes the limits used for new rooms.
+func (r *RoomList) SetLimits(limits Limits) {
+	r.limitsLock.Lock()
+	defer r.limitsLock.Unlock()
+	r.limits = limits
+}
+
+// GetLimits returns the limits currently in use.
+func (r *RoomList) GetLimits() Limits {
+	r.limitsLock.RLock()
+	defer r.limitsLock.RUnlock()
+	return r.limits
 }
 
 func (r *RoomList) CreateRoom(
@@ -46,105 +195,411 @@ func (r *RoomList) CreateRoom(
 	roomName string,
 	options *proto_lobby.RoomOptions) (*proto_lobby.Room, proto_lobby.CreateRoomResponse_ErrorCode) {
 
-	if r.isPlayerInRoom(userId) {
-		return nil, proto_lobby.CreateRoomResponse_ALREADY_IN_ROOM
+	limits := r.GetLimits()
+	roomName, err := NormalizeRoomName(roomName, limits.MaxNameLength, r.BlocksName)
+	if err != nil {
+		return nil, nameErrorCode(err)
+	}
+	maxPlayers := limits.MaxPlayers
+	if options != nil && options.MaxPlayers != nil {
+		maxPlayers = uint(options.GetMaxPlayers())
+		if !validMaxPlayers(maxPlayers, limits) {
+			return nil, proto_lobby.CreateRoomResponse_INVALID_MAX_PLAYERS
+		}
 	}
 
-	room := NewRoom(roomName, userId, 4)
-	r.setPlayerRoom(userId, room.id)
-	r.roomsLock.Lock()
-	defer r.roomsLock.Unlock()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.players[userId]; ok {
+		return nil, proto_lobby.CreateRoomResponse_ALREADY_IN_ROOM
+	}
+	if limits.MaxRooms != 0 && uint(len(r.rooms)) >= limits.MaxRooms {
+		return nil, proto_lobby.CreateRoomResponse_ROOM_LIMIT_REACHED
+	}
+	// The room is only made once it is certain to be added, every room runs
+	// until it is closed.
+	room := newRoom(roomName, userId, maxPlayers, options, r.versions)
+	room.ReadyTimeout = limits.ReadyTimeout
+	room.Clock = r.scheduler
+	room.ListLock = r.lock
+	room.PlayersDropped = r.playersDropped
+	room.ReadyCheckChanged = r.readyCheckChanged
+	r.players[userId] = room.id
 	r.rooms[room.id] = room
+	r.publishRooms()
 	log.Printf("User [id=%s] created a room [id=%s]", userId, room.id)
-	return room.Proto(), 0
+	r.touchRoom(room)
+	roomProto := room.Proto()
+	// Only the owner learns about a private room, other players join it with
+	// the id they were given.
+	var users []user.Id
+	if room.IsPrivate() {
+		users = append(users, userId)
+	}
+	r.notifyAsync(&proto_lobby.RoomCreatedEvent{
+		Room: roomProto,
+	}, users...)
+	return roomProto, 0
 }
 
+// nameErrorCode returns the error code of a room name that is not allowed.
+func nameErrorCode(err error) proto_lobby.CreateRoomResponse_ErrorCode {
+	switch err {
+	case ErrNameEmpty:
+		return proto_lobby.CreateRoomResponse_NAME_EMPTY
+	case ErrNameTooLong:
+		return proto_lobby.CreateRoomResponse_NAME_TOO_LONG
+	case ErrNameConfusable:
+		return proto_lobby.CreateRoomResponse_NAME_CONFUSABLE
+	case ErrNameBlocked:
+		return proto_lobby.CreateRoomResponse_NAME_BLOCKED
+	}
+	return proto_lobby.CreateRoomResponse_NAME_INVALID_CHARACTERS
+}
+
+// JoinRoom adds the user to the room, a user already in another room leaves
+// it first. Nothing changes if the user can't join, joining the room the user
+// is already in returns that room. Players kicked from the room by vote can't
+// join it until KickCooldown ends.
 func (r *RoomList) JoinRoom(
 	userId user.Id,
 	roomId RoomId) (*proto_lobby.Room, proto_lobby.JoinRoomResponse_ErrorCode) {
 
-	room := r.findRoom(roomId)
-	if r.isPlayerInRoom(userId) {
-		r.LeaveRoom(userId)
-	}
+	return r.JoinRoomWithPassword(userId, roomId, "")
+}
+
+// JoinRoomWithPassword is like JoinRoom but joins rooms protected by the
+// password as well.
+func (r *RoomList) JoinRoomWithPassword(
+	userId user.Id,
+	roomId RoomId,
+	password string) (*proto_lobby.Room, proto_lobby.JoinRoomResponse_ErrorCode) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[roomId]
 	if room == nil {
 		return nil, proto_lobby.JoinRoomResponse_ROOM_DOES_NOT_EXIST
 	}
+	current := r.rooms[r.players[userId]]
+	if current == room {
+		return room.Proto(), 0
+	}
+	if !room.CheckPassword(password) {
+		return nil, proto_lobby.JoinRoomResponse_WRONG_PASSWORD
+	}
+	if r.isKicked(roomId, userId) {
+		return nil, proto_lobby.JoinRoomResponse_KICKED
+	}
+	if room.NumPlayers() >= room.MaxPlayers() {
+		return nil, proto_lobby.JoinRoomResponse_ROOM_FULL
+	}
+	if current != nil {
+		if err := r.leave(current, userId); err != nil {
+			return nil, proto_lobby.JoinRoomResponse_GAME_STARTING
+		}
+	}
+	if err := r.join(room, userId); err != nil {
+		return nil, proto_lobby.JoinRoomResponse_ROOM_FULL
+	}
+	return room.Proto(), 0
+}
+
+// join adds the user to the room and notifies the players already in it.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) join(room *Room, userId user.Id) error {
 	usersInRoom := room.GetUserIds()
-	r.setPlayerRoom(userId, roomId)
 	if err := room.Join(userId); err != nil {
-		return nil, proto_lobby.JoinRoomResponse_ROOM_FULL
+		return err
 	}
+	r.players[userId] = room.id
 	log.Printf("User [id=%s] joined room [id=%s]", userId, room.id)
+	r.touchRoom(room)
 	r.notifyAsync(&proto_lobby.JoinRoomEvent{
 		Player: pbuf.String(userId.String()),
 	}, usersInRoom...)
-	return room.Proto(), 0
+	r.sendChatHistory(room, userId)
+	return nil
 }
 
+// LeaveRoom removes the user from their room. Players can't leave while the
+// ready check they are part of is in progress.
 func (r *RoomList) LeaveRoom(userId user.Id) (bool, proto_lobby.LeaveRoomResponse_ErrorCode) {
-	roomId := r.findPlayerRoom(userId)
-	room := r.findRoom(roomId)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[r.players[userId]]
 	if room == nil {
 		return false, proto_lobby.LeaveRoomResponse_NOT_IN_ROOM
 	}
-	r.removePlayerRoom(userId)
-	// TODO: handle error
-	if notEmpty, _ := room.Leave(userId); !notEmpty {
-		r.removeRoom(roomId)
+	if err := r.leave(room, userId); err != nil {
+		return false, proto_lobby.LeaveRoomResponse_GAME_STARTING
 	}
+	return true, 0
+}
+
+// leave removes the user from the room and removes the room if it is left
+// empty. The room is left unchanged if the user can't leave it.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) leave(room *Room, userId user.Id) error {
+	notEmpty, err := room.Leave(userId)
+	if err != nil {
+		return err
+	}
+	delete(r.players, userId)
 	log.Printf("User [id=%s] left room [id=%s]", userId, room.id)
-	r.notifyAsync(&proto_lobby.JoinRoomEvent{
+	if !notEmpty {
+		delete(r.rooms, room.id)
+		r.publishRooms()
+		r.stopIdle(room.id)
+		delete(r.chats, room.id)
+		delete(r.kicked, room.id)
+		r.stopVote(room.id)
+		room.Close()
+		if !room.IsPrivate() {
+			r.notifyAsync(&proto_lobby.RoomRemovedEvent{
+				RoomId: pbuf.String(room.id.String()),
+			})
+		}
+		return nil
+	}
+	r.touchRoom(room)
+	r.notifyAsync(&proto_lobby.LeaveRoomEvent{
 		Player: pbuf.String(userId.String()),
 	}, room.GetUserIds()...)
-	return true, 0
+	r.memberLeft(room, userId)
+	return nil
 }
 
 func (r *RoomList) ListRoomsExcluding(userId user.Id) []*proto_lobby.Room {
-	r.roomsLock.RLock()
-	defer r.roomsLock.RUnlock()
-	roomList := make([]*proto_lobby.Room, 0, len(r.rooms))
-	for _, room := range r.rooms {
-		if room.owner == userId {
-			continue
+	rooms, _, _ := r.ListRoomsChangedSince(userId, 0)
+	return rooms
+}
+
+// ListRoomsChangedSince returns the rooms, except the ones owned by the user
+// and the private ones, and the version of the list. The returned rooms include all the changes up
+// to the version, they may include later changes as well. If the list and its
+// rooms did not change since version since no rooms are returned and changed
+// is false.
+func (r *RoomList) ListRoomsChangedSince(
+	userId user.Id,
+	since uint64) (rooms []*proto_lobby.Room, version uint64, changed bool) {
+
+	version = r.versions.current()
+	if version <= since {
+		return nil, version, false
+	}
+	published := r.publishedRooms()
+	rooms = make([]*proto_lobby.Room, 0, len(published))
+	for _, room := range published {
+		s := room.load()
+		if s.owner != userId && !s.options.GetPrivate() {
+			rooms = append(rooms, s.proto)
 		}
-		roomList = append(roomList, room.Proto())
 	}
-	return roomList
+	return rooms, version, true
 }
 
 func (r *RoomList) GetRoom(roomId RoomId) *proto_lobby.Room {
-	r.roomsLock.RLock()
-	defer r.roomsLock.RUnlock()
-	room := r.findRoom(roomId)
+	room := r.publishedRooms()[roomId]
 	if room != nil {
 		return room.Proto()
 	}
 	return nil
 }
 
+// publishRooms publishes a copy of the rooms for the reads with a new version.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) publishRooms() {
+	rooms := make(Rooms, len(r.rooms))
+	for roomId, room := range r.rooms {
+		rooms[roomId] = room
+	}
+	r.versions.publish(func(version uint64) {
+		r.published.Store(rooms)
+	})
+}
+
+// publishedRooms returns the last published copy of the rooms, it must not be
+// modified.
+func (r *RoomList) publishedRooms() Rooms {
+	return r.published.Load().(Rooms)
+}
+
 var (
 	ErrNotInRoom = errors.New("User must create a room before starting the game")
 	ErrNotOwner  = errors.New("Only owner can start the game")
+	// ErrVersionConflict is returned if the room changed since the version
+	// the request expected.
+	ErrVersionConflict = errors.New("Room changed since the expected version")
 )
 
-func (r *RoomList) StartGame(userId user.Id) error {
-	if !r.isPlayerInRoom(userId) {
-		return ErrNotInRoom
-	}
-	room := r.getPlayerRoom(userId)
-	if room.GetOwner() != userId {
-		return ErrNotOwner
+// AnyVersion is passed as the expected version of a room to skip the version
+// check.
+const AnyVersion uint64 = 0
+
+// OwnRoom is passed as the room of owner actions to act on the user's own
+// room. Users that manage rooms can name any other room instead.
+const OwnRoom RoomId = ""
+
+// StartGame starts the ready check in the room.
+func (r *RoomList) StartGame(userId user.Id, roomId RoomId, expectedVersion uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room, err := r.managedRoom(userId, roomId, expectedVersion)
+	if err != nil {
+		return err
 	}
-	log.Printf("Owner [id=%s] started the game in room [id=%s]", userId, room.GetId())
+	log.Printf("User [id=%s] started the game in room [id=%s]", userId, room.GetId())
 	userState, err := room.StartGame()
 	if err != nil {
 		return err
 	}
+	r.touchRoom(room)
 	r.notifyGameStart(room, userState)
 	return nil
 }
 
+// ForceStart starts the game in the room without waiting for all the players
+// to confirm they are ready, if the room's ready policy allows it.
+func (r *RoomList) ForceStart(userId user.Id, roomId RoomId, expectedVersion uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room, err := r.managedRoom(userId, roomId, expectedVersion)
+	if err != nil {
+		return err
+	}
+	log.Printf("User [id=%s] forced the start of the game in room [id=%s]", userId, room.GetId())
+	if err := room.ForceStart(); err != nil {
+		return err
+	}
+	r.touchRoom(room)
+	return nil
+}
+
+// CancelStart cancels the ready check in the room.
+func (r *RoomList) CancelStart(userId user.Id, roomId RoomId, expectedVersion uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room, err := r.managedRoom(userId, roomId, expectedVersion)
+	if err != nil {
+		return err
+	}
+	log.Printf("User [id=%s] cancelled the start of the game in room [id=%s]", userId, room.GetId())
+	if err := room.CancelStart(); err != nil {
+		return err
+	}
+	r.touchRoom(room)
+	return nil
+}
+
+// managedRoom returns the room with the id, or the user's room for OwnRoom,
+// if the user can perform owner actions in it and it is still at the
+// expected version.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) managedRoom(userId user.Id, roomId RoomId, expectedVersion uint64) (*Room, error) {
+	var room *Room
+	if roomId == OwnRoom {
+		room = r.rooms[r.players[userId]]
+		if room == nil {
+			return nil, ErrNotInRoom
+		}
+	} else {
+		room = r.rooms[roomId]
+		if room == nil {
+			return nil, ErrRoomNotFound
+		}
+	}
+	if !r.canManage(room, userId) {
+		return nil, ErrNotOwner
+	}
+	if err := checkVersion(room, expectedVersion); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// checkVersion returns ErrVersionConflict if the room is not at the expected
+// version. Rooms only change while the list's lock is owned so the room stays
+// at the version until the lock is released.
+// This method should only be called while owning the list's lock.
+func checkVersion(room *Room, expectedVersion uint64) error {
+	if expectedVersion != AnyVersion && room.Version() != expectedVersion {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// GetMyRoom returns the status of the user's room so a client can resume
+// after restarting.
+func (r *RoomList) GetMyRoom(userId user.Id) (PlayerStatus, error) {
+	room := r.getPlayerRoom(userId)
+	if room == nil {
+		return PlayerStatus{}, ErrNotInRoom
+	}
+	status, ok := room.PlayerStatus(userId)
+	if !ok {
+		return PlayerStatus{}, ErrNotInRoom
+	}
+	status.Vote = r.currentVote(room.GetId())
+	return status, nil
+}
+
+// readyCheckChanged notifies all the players in a room about the progress of
+// its ready check.
+func (r *RoomList) readyCheckChanged(room *Room, change ReadyCheckChange) {
+	roomId := pbuf.String(room.GetId().String())
+	var msg proto.ProtobufMessage
+	switch change.Status {
+	case ReadyCheckStarted:
+		msg = &proto_lobby.ReadyCheckStartedEvent{
+			RoomId:   roomId,
+			Deadline: pbuf.Int64(change.Deadline.UnixNano() / int64(time.Millisecond)),
+		}
+	case ReadyCheckProgress:
+		msg = &proto_lobby.ReadyCheckProgressEvent{
+			RoomId: roomId,
+			Ready:  toStringSlice(change.Users),
+		}
+	case ReadyCheckFailed:
+		log.Printf("Players %v in room [id=%s] did not confirm they are ready", change.Users, room.GetId())
+		r.touchRoom(room)
+		msg = &proto_lobby.ReadyCheckFailedEvent{
+			RoomId:   roomId,
+			NotReady: toStringSlice(change.Users),
+		}
+	case ReadyCheckCancelled:
+		msg = &proto_lobby.ReadyCheckCancelledEvent{
+			RoomId: roomId,
+		}
+	default:
+		return
+	}
+	r.notifyAsync(msg, room.GetUserIds()...)
+}
+
+// playersDropped removes players that were dropped from a room because they
+// were not ready and notifies them and the players remaining in the room.
+func (r *RoomList) playersDropped(room *Room, userIds []user.Id) {
+	for _, userId := range userIds {
+		if r.players[userId] == room.GetId() {
+			delete(r.players, userId)
+		}
+		log.Printf("User [id=%s] was not ready and was removed from room [id=%s]", userId, room.GetId())
+	}
+	r.touchRoom(room)
+	remaining := room.GetUserIds()
+	for _, userId := range userIds {
+		r.notifyAsync(&proto_lobby.PlayerRemovedEvent{
+			RoomId: pbuf.String(room.GetId().String()),
+			Player: pbuf.String(userId.String()),
+			Reason: proto_lobby.PlayerRemovedEvent_NOT_READY.Enum(),
+		}, append([]user.Id{userId}, remaining...)...)
+	}
+	for _, userId := range userIds {
+		r.memberLeft(room, userId)
+	}
+}
+
 func (r *RoomList) notifyGameStart(room *Room, userState map[user.Id]string) {
 	for _, userId := range room.GetNonOwnerUserIds() {
 		log.Printf("State for user [id=%s] is %s", userId, userState[userId])
@@ -156,15 +611,18 @@ func (r *RoomList) notifyGameStart(room *Room, userState map[user.Id]string) {
 }
 
 func (r *RoomList) PlayerReady(userId user.Id, state string) error {
-	if !r.isPlayerInRoom(userId) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[r.players[userId]]
+	if room == nil {
 		return ErrNotInRoom
 	}
-	room := r.getPlayerRoom(userId)
 	err := room.PlayerReady(userId, state)
 	if err != nil {
 		return err
 	}
 	log.Printf("Player [id=%s] in room [id=%s] is ready", userId, room.GetId())
+	r.touchRoom(room)
 	r.notifyPlayerReady(room, userId)
 	return nil
 }
@@ -175,55 +633,44 @@ func (r *RoomList) notifyPlayerReady(room *Room, readyUserId user.Id) {
 			continue
 		}
 		r.notifyAsync(&proto_lobby.PlayerReadyEvent{
-			UserId: pbuf.String(userId.String()),
+			UserId: pbuf.String(readyUserId.String()),
 		}, userId)
 	}
 }
 
-func (r *RoomList) getPlayerRoom(userId user.Id) *Room {
-	return r.findRoom(r.findPlayerRoom(userId))
-}
-
-func (r *RoomList) findRoom(roomId RoomId) *Room {
-	r.roomsLock.RLock()
-	defer r.roomsLock.RUnlock()
-	return r.rooms[roomId]
-}
-
-func (r *RoomList) removeRoom(roomId RoomId) {
-	r.roomsLock.RLock()
-	defer r.roomsLock.RUnlock()
-	delete(r.rooms, roomId)
-}
-
-func (r *RoomList) findPlayerRoom(userId user.Id) RoomId {
-	r.playersLock.RLock()
-	defer r.playersLock.RUnlock()
-	return r.players[userId]
-}
-
-func (r *RoomList) isPlayerInRoom(userId user.Id) bool {
-	return r.findPlayerRoom(userId) != ""
-}
-
-func (r *RoomList) setPlayerRoom(userId user.Id, roomId RoomId) {
-	r.playersLock.Lock()
-	defer r.playersLock.Unlock()
-	r.players[userId] = roomId
+// canManage returns true if the user can perform owner actions in the room.
+func (r *RoomList) canManage(room *Room, userId user.Id) bool {
+	if room.GetOwner() == userId {
+		return true
+	}
+	return r.ManagesRooms != nil && r.ManagesRooms(userId)
 }
 
-func (r *RoomList) removePlayerRoom(userId user.Id) {
-	r.playersLock.Lock()
-	defer r.playersLock.Unlock()
-	delete(r.players, userId)
+// getPlayerRoom returns the user's room or nil if the user is not in a room.
+func (r *RoomList) getPlayerRoom(userId user.Id) *Room {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.rooms[r.players[userId]]
 }
 
+// notifyAsync sends msg to users. Event listeners are called before
+// returning, notifications through the notify service are sent asynchronously.
+// If no users are given, or the room list has no notify client, only the
+// event listeners receive the message. Errors of the notify service are
+// logged.
 func (r *RoomList) notifyAsync(msg proto.ProtobufMessage, users ...user.Id) {
+	r.listenersLock.Lock()
+	for _, l := range r.listeners {
+		l(msg, users)
+	}
+	r.listenersLock.Unlock()
+	if len(users) == 0 || r.notifyClient == nil {
+		return
+	}
 	go func() {
-		// TODO: handle response
-		//_, err := r.notifyClient.MessageUsers(msg, users...)
-		//if err != nil {
-		//log.Printf("Error sending notifictations to clients: %s", err)
-		//}
+		_, err := r.notifyClient.MessageUsers(msg, users...)
+		if err != nil {
+			log.Printf("Error sending notifications to users %v: %s", users, err)
+		}
 	}()
 }
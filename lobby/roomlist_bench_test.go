@@ -0,0 +1,107 @@
+package lobby_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// quietLog discards the log of the room list until the returned function is
+// called.
+func quietLog() func() {
+	log.SetOutput(ioutil.Discard)
+	return func() {
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// benchRoomList returns a room list with numRooms rooms that each have one
+// free seat.
+func benchRoomList(numRooms int) (*lobby.RoomList, []lobby.RoomId) {
+	roomList := lobby.NewRoomList(nil)
+	limits := roomList.GetLimits()
+	limits.MaxPlayers = 4
+	roomList.SetLimits(limits)
+	roomIds := make([]lobby.RoomId, 0, numRooms)
+	for i := 0; i < numRooms; i++ {
+		room, _ := roomList.CreateRoom(user.Id(fmt.Sprintf("owner-%d", i)), "bench", nil)
+		roomId := lobby.RoomId(room.GetId())
+		roomList.JoinRoom(user.Id(fmt.Sprintf("player-%d", i)), roomId)
+		roomList.JoinRoom(user.Id(fmt.Sprintf("other-%d", i)), roomId)
+		roomIds = append(roomIds, roomId)
+	}
+	return roomList, roomIds
+}
+
+func BenchmarkListRooms(b *testing.B) {
+	defer quietLog()()
+	roomList, _ := benchRoomList(100)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			roomList.ListRoomsExcluding("")
+		}
+	})
+}
+
+func BenchmarkGetMyRoom(b *testing.B) {
+	defer quietLog()()
+	roomList, _ := benchRoomList(100)
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		userId := user.Id(fmt.Sprintf("player-%d", atomic.AddInt64(&n, 1)%100))
+		for pb.Next() {
+			roomList.GetMyRoom(userId)
+		}
+	})
+}
+
+// BenchmarkJoinLeave moves players between rooms. Every join and leave waits
+// for the room's goroutine while owning the list's lock, run it with
+// -cpu 1,4,8 to see how much the lock is contended.
+func BenchmarkJoinLeave(b *testing.B) {
+	defer quietLog()()
+	roomList, roomIds := benchRoomList(100)
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddInt64(&n, 1)
+		userId := user.Id(fmt.Sprintf("bench-%d", i))
+		for pb.Next() {
+			roomList.JoinRoom(userId, roomIds[i%int64(len(roomIds))])
+			roomList.LeaveRoom(userId)
+			i++
+		}
+	})
+}
+
+// BenchmarkMixed lists rooms and asks for the player's room nine times as
+// often as it moves the player to another room.
+func BenchmarkMixed(b *testing.B) {
+	defer quietLog()()
+	roomList, roomIds := benchRoomList(100)
+	var n int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddInt64(&n, 1)
+		userId := user.Id(fmt.Sprintf("bench-%d", i))
+		for pb.Next() {
+			switch i % 10 {
+			case 0:
+				roomList.JoinRoom(userId, roomIds[i%int64(len(roomIds))])
+			case 1, 2, 3, 4:
+				roomList.ListRoomsExcluding(userId)
+			default:
+				roomList.GetMyRoom(userId)
+			}
+			i++
+		}
+	})
+}
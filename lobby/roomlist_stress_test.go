@@ -0,0 +1,229 @@
+package lobby_test
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// stressRoomList runs random operations on the room list from many
+// goroutines while the clock keeps advancing so the ready checks, idle
+// timeouts and disconnects fire in between. The invariants are checked while
+// the operations are running and once they are done.
+func stressRoomList(t *testing.T, seed int64) {
+	workers, ops := 16, 500
+	if testing.Short() {
+		ops = 100
+	}
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	roomList := lobby.NewRoomListWithClock(nil, clock)
+	roomList.SetLimits(lobby.Limits{
+		MaxRooms:          6,
+		MaxPlayers:        3,
+		ReadyTimeout:      time.Second,
+		IdleTtl:           20 * time.Second,
+		InProgressIdleTtl: 10 * time.Second,
+		IdleWarning:       2 * time.Second,
+		HeartbeatTimeout:  3 * time.Second,
+		DisconnectGrace:   2 * time.Second,
+	})
+	roomList.ManagesRooms = func(userId user.Id) bool {
+		return userId == "0"
+	}
+
+	var done int32
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for atomic.LoadInt32(&done) == 0 {
+			clock.Advance(100 * time.Millisecond)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	var violations int32
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for atomic.LoadInt32(&done) == 0 {
+			if err := roomList.CheckInvariants(); err != nil {
+				if atomic.AddInt32(&violations, 1) == 1 {
+					t.Errorf("Invariants violated while running: %s", err)
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				randomOperation(roomList, rng, user.Id(strconv.Itoa(rng.Intn(24))))
+			}
+		}(rand.New(rand.NewSource(seed + int64(w))))
+	}
+	wg.Wait()
+	atomic.StoreInt32(&done, 1)
+	background.Wait()
+
+	assert.NoError(t, roomList.CheckInvariants())
+	// Let every pending timeout fire and check the rooms are still consistent.
+	clock.Advance(time.Minute)
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+var readyPolicies = []proto_lobby.RoomOptions_ReadyPolicy{
+	proto_lobby.RoomOptions_ALL_READY,
+	proto_lobby.RoomOptions_QUORUM,
+	proto_lobby.RoomOptions_DROP_NOT_READY,
+	proto_lobby.RoomOptions_OWNER_FORCE,
+}
+
+// randomOperation performs an operation chosen at random as the user.
+func randomOperation(roomList *lobby.RoomList, rng *rand.Rand, userId user.Id) {
+	switch rng.Intn(19) {
+	case 0:
+		roomList.CreateRoom(userId, "stress", &proto_lobby.RoomOptions{
+			ReadyPolicy: readyPolicies[rng.Intn(len(readyPolicies))].Enum(),
+			ReadyQuorum: pbuf.Uint32(2),
+		})
+	case 1, 2:
+		if roomId, ok := randomRoom(roomList, rng); ok {
+			roomList.JoinRoom(userId, roomId)
+		}
+	case 3:
+		roomList.LeaveRoom(userId)
+	case 4, 5:
+		roomList.StartGame(userId, lobby.OwnRoom, lobby.AnyVersion)
+	case 6:
+		roomList.ForceStart(userId, lobby.OwnRoom, lobby.AnyVersion)
+	case 7:
+		roomList.CancelStart(userId, lobby.OwnRoom, lobby.AnyVersion)
+	case 8, 9, 10:
+		if status, err := roomList.GetMyRoom(userId); err == nil && status.Starting {
+			roomList.PlayerReady(userId, status.State)
+		}
+	case 11:
+		roomList.Disconnected(userId)
+	case 12:
+		roomList.Connected(userId)
+	case 13:
+		roomList.Heartbeat(userId)
+	case 14:
+		switch rng.Intn(3) {
+		case 0:
+			roomList.RemovePlayer(userId, lobby.AnyVersion)
+		case 1:
+			if roomId, ok := randomRoom(roomList, rng); ok {
+				roomList.MovePlayer(userId, roomId)
+			}
+		case 2:
+			if roomId, ok := randomRoom(roomList, rng); ok {
+				roomList.CancelRoomStart(roomId, lobby.AnyVersion)
+			}
+		}
+	case 15:
+		if rng.Intn(10) == 0 {
+			if roomId, ok := randomRoom(roomList, rng); ok {
+				roomList.CloseRoom(roomId)
+			}
+		} else {
+			roomList.RoomStates()
+		}
+	case 16:
+		roomList.UpdateRoom(userId, lobby.OwnRoom, "updated", &proto_lobby.RoomOptions{
+			MaxPlayers:  pbuf.Uint32(uint32(1 + rng.Intn(3))),
+			ReadyPolicy: readyPolicies[rng.Intn(len(readyPolicies))].Enum(),
+			ReadyQuorum: pbuf.Uint32(2),
+		}, lobby.AnyVersion)
+	case 17:
+		if rng.Intn(4) == 0 {
+			roomList.MuteMember(userId, lobby.OwnRoom, user.Id(strconv.Itoa(rng.Intn(24))), rng.Intn(2) == 0)
+		} else {
+			roomList.SendRoomMessage(userId, "stress")
+		}
+	case 18:
+		status, err := roomList.GetMyRoom(userId)
+		if err != nil {
+			return
+		}
+		if status.Vote != nil {
+			roomList.CastVote(userId, status.Vote.GetId(), rng.Intn(2) == 0)
+		} else {
+			target := user.Id(strconv.Itoa(rng.Intn(24)))
+			roomList.StartVote(userId, lobby.VoteKind(rng.Intn(3)), target, status.Room.GetVersion())
+		}
+	}
+}
+
+// randomRoom returns the id of one of the rooms in the list.
+func randomRoom(roomList *lobby.RoomList, rng *rand.Rand) (lobby.RoomId, bool) {
+	rooms := roomList.ListRoomsExcluding("")
+	if len(rooms) == 0 {
+		return "", false
+	}
+	return lobby.RoomId(rooms[rng.Intn(len(rooms))].GetId()), true
+}
+
+func TestConcurrentOperationsKeepInvariants(t *testing.T) {
+	for seed := int64(1); seed <= 3; seed++ {
+		stressRoomList(t, seed*1000)
+	}
+}
+
+func TestCheckInvariantsOnConsistentList(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+func TestFailedJoinKeepsPlayerInRoom(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	limits := roomList.GetLimits()
+	limits.MaxPlayers = 2
+	roomList.SetLimits(limits)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	full, _ := roomList.CreateRoom("2", "full", nil)
+	roomList.JoinRoom("3", lobby.RoomId(full.GetId()))
+	roomList.JoinRoom("4", lobby.RoomId(room.GetId()))
+
+	_, errCode := roomList.JoinRoom("4", lobby.RoomId(full.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_ROOM_FULL, errCode)
+	status, err := roomList.GetMyRoom("4")
+	if assert.NoError(t, err) {
+		assert.Equal(t, room.GetId(), status.Room.GetId())
+	}
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+func TestPlayerCantLeaveDuringReadyCheck(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	other, _ := roomList.CreateRoom("3", "other", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+
+	ok, errCode := roomList.LeaveRoom("2")
+	assert.False(t, ok)
+	assert.Equal(t, proto_lobby.LeaveRoomResponse_GAME_STARTING, errCode)
+	_, joinErrCode := roomList.JoinRoom("2", lobby.RoomId(other.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_GAME_STARTING, joinErrCode)
+	assert.Len(t, roomList.GetRoom(lobby.RoomId(room.GetId())).GetPlayers(), 1)
+	assert.NoError(t, roomList.CheckInvariants())
+}
@@ -0,0 +1,299 @@
+package lobby_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// makeRoomList returns a room list with a fake clock and a function
+// returning all the events sent so far.
+func makeRoomList() (*lobby.RoomList, *util.FakeClock, func() []proto.ProtobufMessage) {
+	clock := util.NewFakeClock(time.Unix(0, 0))
+	roomList := lobby.NewRoomListWithClock(nil, clock)
+	var events []proto.ProtobufMessage
+	roomList.AddEventListener(func(msg proto.ProtobufMessage, users []user.Id) {
+		events = append(events, msg)
+	})
+	return roomList, clock, func() []proto.ProtobufMessage {
+		return events
+	}
+}
+
+func setIdleLimits(roomList *lobby.RoomList, ttl, inProgressTtl, warning time.Duration) {
+	limits := roomList.GetLimits()
+	limits.IdleTtl = ttl
+	limits.InProgressIdleTtl = inProgressTtl
+	limits.IdleWarning = warning
+	roomList.SetLimits(limits)
+}
+
+func countEvents(events []proto.ProtobufMessage, msgType proto.Type) int {
+	n := 0
+	for _, event := range events {
+		if event.GetMessageType() == msgType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestIdleRoomIsClosedAfterWarning(t *testing.T) {
+	roomList, clock, events := makeRoomList()
+	setIdleLimits(roomList, 10*time.Minute, time.Hour, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	clock.Advance(9 * time.Minute)
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.RoomIdleWarningEventMessage))
+	assert.NotNil(t, roomList.GetRoom(lobby.RoomId(room.GetId())), "Room is only closed after the warning")
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.RoomClosedEventMessage))
+	assert.Nil(t, roomList.GetRoom(lobby.RoomId(room.GetId())))
+	_, errCode := roomList.LeaveRoom("2")
+	assert.Equal(t, proto_lobby.LeaveRoomResponse_NOT_IN_ROOM, errCode, "Players are removed with the room")
+	_, errCode2 := roomList.CreateRoom("1", "room", nil)
+	assert.Equal(t, 0, errCode2, "Owner can create a new room")
+}
+
+func TestActivityPostponesIdleClose(t *testing.T) {
+	roomList, clock, events := makeRoomList()
+	setIdleLimits(roomList, 10*time.Minute, time.Hour, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+
+	clock.Advance(9*time.Minute + 30*time.Second)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	clock.Advance(time.Minute)
+	assert.NotNil(t, roomList.GetRoom(lobby.RoomId(room.GetId())), "Activity after the warning keeps the room open")
+	assert.Equal(t, 0, countEvents(events(), proto_lobby.RoomClosedEventMessage))
+
+	clock.Advance(9 * time.Minute)
+	assert.Nil(t, roomList.GetRoom(lobby.RoomId(room.GetId())))
+}
+
+func TestRoomWithGameInProgressUsesLongerTtl(t *testing.T) {
+	roomList, clock, _ := makeRoomList()
+	setIdleLimits(roomList, 10*time.Minute, time.Hour, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+
+	clock.Advance(30 * time.Minute)
+	assert.NotNil(t, roomList.GetRoom(lobby.RoomId(room.GetId())))
+	clock.Advance(30 * time.Minute)
+	assert.Nil(t, roomList.GetRoom(lobby.RoomId(room.GetId())))
+}
+
+func TestZeroIdleTtlKeepsRoomsOpen(t *testing.T) {
+	roomList, clock, _ := makeRoomList()
+	setIdleLimits(roomList, 0, 0, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+
+	clock.Advance(24 * time.Hour)
+	assert.NotNil(t, roomList.GetRoom(lobby.RoomId(room.GetId())))
+}
+
+func setPresenceLimits(roomList *lobby.RoomList, heartbeatTimeout, grace time.Duration) {
+	limits := roomList.GetLimits()
+	limits.HeartbeatTimeout = heartbeatTimeout
+	limits.DisconnectGrace = grace
+	// Rooms are kept open regardless of how long the tests run.
+	limits.IdleTtl = 0
+	limits.InProgressIdleTtl = 0
+	roomList.SetLimits(limits)
+}
+
+func TestDisconnectedPlayerIsRemovedAfterGracePeriod(t *testing.T) {
+	roomList, clock, events := makeRoomList()
+	setPresenceLimits(roomList, 30*time.Second, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.Connected("2")
+	roomList.Disconnected("2")
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.PlayerDisconnectedEventMessage))
+
+	clock.Advance(time.Minute - time.Second)
+	assert.Equal(t, 1, len(roomList.GetRoom(lobby.RoomId(room.GetId())).Players))
+	clock.Advance(time.Second)
+	assert.Empty(t, roomList.GetRoom(lobby.RoomId(room.GetId())).Players)
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.PlayerRemovedEventMessage))
+}
+
+func TestDisconnectedOwnerIsSucceeded(t *testing.T) {
+	roomList, clock, _ := makeRoomList()
+	setPresenceLimits(roomList, 30*time.Second, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.Connected("1")
+	roomList.Disconnected("1")
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, "2", roomList.GetRoom(lobby.RoomId(room.GetId())).GetOwner())
+}
+
+func TestPlayerReconnectingWithinGracePeriodKeepsSeat(t *testing.T) {
+	roomList, clock, events := makeRoomList()
+	setPresenceLimits(roomList, 30*time.Second, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.Connected("2")
+	roomList.Disconnected("2")
+
+	clock.Advance(30 * time.Second)
+	roomList.Connected("2")
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, len(roomList.GetRoom(lobby.RoomId(room.GetId())).Players))
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.PlayerReconnectedEventMessage))
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.RoomSnapshotEventMessage))
+}
+
+func TestPlayerStaysConnectedWhileAnySessionIsOpen(t *testing.T) {
+	roomList, clock, events := makeRoomList()
+	setPresenceLimits(roomList, 30*time.Second, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.Connected("2")
+	roomList.Connected("2")
+	roomList.Disconnected("2")
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, 0, countEvents(events(), proto_lobby.PlayerDisconnectedEventMessage))
+	assert.Equal(t, 1, len(roomList.GetRoom(lobby.RoomId(room.GetId())).Players))
+}
+
+func TestMissingHeartbeatsDisconnectPlayer(t *testing.T) {
+	roomList, clock, events := makeRoomList()
+	setPresenceLimits(roomList, 30*time.Second, time.Minute)
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.Heartbeat("2")
+	clock.Advance(20 * time.Second)
+	roomList.Heartbeat("2")
+	clock.Advance(20 * time.Second)
+	assert.Equal(t, 0, countEvents(events(), proto_lobby.PlayerDisconnectedEventMessage))
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.PlayerDisconnectedEventMessage))
+	clock.Advance(time.Minute)
+	assert.Empty(t, roomList.GetRoom(lobby.RoomId(room.GetId())).Players)
+}
+
+func TestGetMyRoomRequiresRoom(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	_, err := roomList.GetMyRoom("1")
+	assert.Equal(t, lobby.ErrNotInRoom, err)
+}
+
+func TestGetMyRoomDuringReadyCheck(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	var state string
+	roomList.AddEventListener(func(msg proto.ProtobufMessage, users []user.Id) {
+		if event, ok := msg.(*proto_lobby.StartGameEvent); ok {
+			state = event.GetState()
+		}
+	})
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+
+	status, err := roomList.GetMyRoom("2")
+	assert.Nil(t, err)
+	assert.Equal(t, room.GetId(), status.Room.GetId())
+	assert.True(t, status.Starting)
+	assert.False(t, status.Ready)
+	assert.Equal(t, state, status.State, "Ready state token can be recovered")
+
+	roomList.PlayerReady("2", status.State)
+	status, _ = roomList.GetMyRoom("2")
+	assert.True(t, status.InProgress)
+	assert.Equal(t, state, status.State)
+}
+
+func TestOwnerIsReadyDuringReadyCheck(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+	defer roomList.CancelStart("1", lobby.OwnRoom, lobby.AnyVersion)
+
+	status, err := roomList.GetMyRoom("1")
+	assert.Nil(t, err)
+	assert.True(t, status.Ready)
+	assert.Empty(t, status.State)
+}
+
+func TestRejectedCreateRoomDoesNotLeakGoroutines(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	limits := roomList.GetLimits()
+	limits.MaxRooms = 1
+	roomList.SetLimits(limits)
+	roomList.CreateRoom("1", "room", nil)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		_, errCode := roomList.CreateRoom("1", "room", nil)
+		assert.Equal(t, proto_lobby.CreateRoomResponse_ALREADY_IN_ROOM, errCode)
+		_, errCode = roomList.CreateRoom("2", "room", nil)
+		assert.Equal(t, proto_lobby.CreateRoomResponse_ROOM_LIMIT_REACHED, errCode)
+	}
+	assert.True(t, runtime.NumGoroutine() < before+10, "Rejected rooms are not left running")
+}
+
+func TestListRoomsChangedSince(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	rooms, version, changed := roomList.ListRoomsChangedSince("2", 0)
+	assert.True(t, changed)
+	assert.Len(t, rooms, 1)
+
+	_, same, changed := roomList.ListRoomsChangedSince("2", version)
+	assert.False(t, changed)
+	assert.Equal(t, version, same)
+
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	_, newer, changed := roomList.ListRoomsChangedSince("3", version)
+	assert.True(t, changed, "Change to a room changes the list")
+	assert.True(t, newer > version)
+
+	roomList.LeaveRoom("2")
+	roomList.LeaveRoom("1")
+	rooms, _, changed = roomList.ListRoomsChangedSince("3", newer)
+	assert.True(t, changed, "Removing a room changes the list")
+	assert.Empty(t, rooms)
+}
+
+func TestVersionsIncreaseAcrossRestarts(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	for i := 0; i < 10; i++ {
+		roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+		roomList.LeaveRoom("2")
+	}
+	_, version, _ := roomList.ListRoomsChangedSince("3", 0)
+
+	restarted, _, _ := makeRoomList()
+	restarted.CreateRoom("1", "room", nil)
+	rooms, _, changed := restarted.ListRoomsChangedSince("3", version)
+	assert.True(t, changed, "A version from before the restart is older")
+	assert.Len(t, rooms, 1)
+}
+
+func TestStartGameRejectsStaleVersion(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	stale := room.GetVersion()
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	assert.Equal(t, lobby.ErrVersionConflict, roomList.StartGame("1", lobby.OwnRoom, stale))
+	status, _ := roomList.GetMyRoom("1")
+	assert.False(t, status.Starting)
+	assert.NoError(t, roomList.StartGame("1", lobby.OwnRoom, status.Room.GetVersion()))
+}
@@ -0,0 +1,155 @@
+package lobby
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrNameEmpty   = errors.New("Room name is empty")
+	ErrNameTooLong = errors.New("Room name is too long")
+	// ErrNameInvalidCharacters is returned for names with control,
+	// invisible or private use characters.
+	ErrNameInvalidCharacters = errors.New("Room name contains invalid characters")
+	// ErrNameConfusable is returned for names mixing letters of scripts that
+	// look alike, for example a Cyrillic a in a Latin word.
+	ErrNameConfusable = errors.New("Room name mixes letters that look alike")
+	ErrNameBlocked    = errors.New("Room name contains a blocked word")
+)
+
+// confusableScripts are scripts that share many letters that look the same,
+// letters of a name can only come from one of them.
+var confusableScripts = []*unicode.RangeTable{
+	unicode.Latin,
+	unicode.Greek,
+	unicode.Cyrillic,
+}
+
+// NormalizeRoomName returns the name in the form it is shown to the players,
+// or an error if it is not allowed as a room name.
+// The name is normalized to NFKC so characters with the same meaning, like
+// full width letters, are the same, and runs of white space are replaced by a
+// single space. The normalized name must have between 1 and maxLength
+// characters. If blocked is not nil it is called with the normalized name and
+// the name is rejected if it returns true.
+func NormalizeRoomName(name string, maxLength uint, blocked func(name string) bool) (string, error) {
+	// Normalizing can make the name longer but never by more than this, names
+	// that are too long are rejected without looking at them.
+	if uint(len(name)) > maxLength*utf8.UTFMax*norm.MaxSegmentSize {
+		return "", ErrNameTooLong
+	}
+	if !utf8.ValidString(name) {
+		return "", ErrNameInvalidCharacters
+	}
+	name = strings.Join(strings.Fields(norm.NFKC.String(name)), " ")
+	length := uint(utf8.RuneCountInString(name))
+	if length == 0 {
+		return "", ErrNameEmpty
+	}
+	if length > maxLength {
+		return "", ErrNameTooLong
+	}
+	script := -1
+	for _, r := range name {
+		if unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs) || r == utf8.RuneError {
+			return "", ErrNameInvalidCharacters
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for i, table := range confusableScripts {
+			if unicode.Is(table, r) {
+				if script != -1 && script != i {
+					return "", ErrNameConfusable
+				}
+				script = i
+			}
+		}
+	}
+	if blocked != nil && blocked(name) {
+		return "", ErrNameBlocked
+	}
+	return name, nil
+}
+
+// WordList is a word filter blocking names that contain any of its words.
+// Words are compared ignoring case and only whole words match so names
+// containing a blocked word as part of a longer word are allowed. An entry
+// of several words only matches those words in a row.
+type WordList struct {
+	// phrases are the entries split into words, by their first word.
+	phrases map[string][][]string
+}
+
+// NewWordList returns a word list blocking the words.
+func NewWordList(words []string) *WordList {
+	l := &WordList{make(map[string][][]string)}
+	for _, word := range words {
+		if phrase := splitWords(word); len(phrase) > 0 {
+			l.phrases[phrase[0]] = append(l.phrases[phrase[0]], phrase)
+		}
+	}
+	return l
+}
+
+// LoadWordList reads a word list from a file with one word or phrase per
+// line. Empty lines and lines starting with # are skipped.
+func LoadWordList(path string) (*WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordList(words), nil
+}
+
+// Blocks returns true if the name contains one of the words.
+func (l *WordList) Blocks(name string) bool {
+	words := splitWords(name)
+	for i, w := range words {
+		for _, phrase := range l.phrases[w] {
+			if startsWith(words[i:], phrase) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// startsWith checks if the first words are the words of the phrase.
+func startsWith(words, phrase []string) bool {
+	if len(words) < len(phrase) {
+		return false
+	}
+	for i, w := range phrase {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// splitWords returns the lower case words of s, words are separated by
+// anything other than letters and digits.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(norm.NFKC.String(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
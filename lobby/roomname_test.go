@@ -0,0 +1,98 @@
+package lobby_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+func TestRoomNameIsNormalized(t *testing.T) {
+	name, err := lobby.NormalizeRoomName("  Ｒｏｏｍ \t  one ", 32, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Room one", name)
+}
+
+func TestRoomNameLength(t *testing.T) {
+	_, err := lobby.NormalizeRoomName(" \t ", 32, nil)
+	assert.Equal(t, lobby.ErrNameEmpty, err)
+	_, err = lobby.NormalizeRoomName(strings.Repeat("a", 33), 32, nil)
+	assert.Equal(t, lobby.ErrNameTooLong, err)
+	_, err = lobby.NormalizeRoomName(strings.Repeat("a", 1<<20), 32, nil)
+	assert.Equal(t, lobby.ErrNameTooLong, err)
+	_, err = lobby.NormalizeRoomName(strings.Repeat("ž", 32), 32, nil)
+	assert.NoError(t, err, "Length is measured in characters")
+}
+
+func TestRoomNameWithInvalidCharacters(t *testing.T) {
+	for _, name := range []string{"a\x00b", "a\u200bb", "\u202eroom", "room\xff", "\ue000"} {
+		_, err := lobby.NormalizeRoomName(name, 32, nil)
+		assert.Equal(t, lobby.ErrNameInvalidCharacters, err, "Name %q", name)
+	}
+}
+
+func TestRoomNameMixingConfusableScripts(t *testing.T) {
+	_, err := lobby.NormalizeRoomName("p\u0430ypal", 32, nil)
+	assert.Equal(t, lobby.ErrNameConfusable, err, "Cyrillic a in a Latin word")
+	for _, name := range []string{"Привет 42", "Γειά", "部屋 room"} {
+		_, err := lobby.NormalizeRoomName(name, 32, nil)
+		assert.NoError(t, err, "Name %q", name)
+	}
+}
+
+func TestWordListBlocksWholeWords(t *testing.T) {
+	words := lobby.NewWordList([]string{"bad"})
+	assert.True(t, words.Blocks("bad room"))
+	assert.True(t, words.Blocks("BAD-room"))
+	assert.True(t, words.Blocks("ＢＡＤ"))
+	assert.False(t, words.Blocks("badminton"))
+}
+
+func TestWordListBlocksPhrases(t *testing.T) {
+	words := lobby.NewWordList([]string{"son of a"})
+	assert.True(t, words.Blocks("Son of a room"))
+	assert.True(t, words.Blocks("my son-of-a room"))
+	assert.False(t, words.Blocks("of"))
+	assert.False(t, words.Blocks("a son of mine"))
+}
+
+func TestLoadWordList(t *testing.T) {
+	f, err := ioutil.TempFile("", "lobby-words")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# blocked words\nbad\n\n  worse  \n")
+	f.Close()
+
+	words, err := lobby.LoadWordList(f.Name())
+	assert.NoError(t, err)
+	assert.True(t, words.Blocks("worse room"))
+	assert.False(t, words.Blocks("blocked words"))
+
+	_, err = lobby.LoadWordList(f.Name() + "-missing")
+	assert.Error(t, err)
+}
+
+func TestCreateAndUpdateRoomCheckName(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	roomList.BlocksName = lobby.NewWordList([]string{"bad"}).Blocks
+
+	_, errCode := roomList.CreateRoom("1", "", nil)
+	assert.Equal(t, proto_lobby.CreateRoomResponse_NAME_EMPTY, errCode)
+	_, errCode = roomList.CreateRoom("1", "bad room", nil)
+	assert.Equal(t, proto_lobby.CreateRoomResponse_NAME_BLOCKED, errCode)
+
+	room, _ := roomList.CreateRoom("1", " my  room ", nil)
+	assert.Equal(t, "my room", room.GetName())
+	_, err := roomList.UpdateRoom("1", lobby.OwnRoom, "bad", nil, lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrNameBlocked, err)
+	updated, err := roomList.UpdateRoom("1", lobby.OwnRoom, "ｇｏｏｄ", nil, lobby.AnyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, "good", updated.GetName())
+}
@@ -0,0 +1,136 @@
+package lobby
+
+import (
+	"errors"
+	"log"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+)
+
+var (
+	// ErrGameInProgress is returned by UpdateRoom if the game in the room
+	// already started.
+	ErrGameInProgress = errors.New("Room game in progress")
+	// ErrInvalidMaxPlayers is returned by UpdateRoom if the max players is
+	// zero or over the limit of the room list.
+	ErrInvalidMaxPlayers = errors.New("Invalid max players")
+	// ErrTooManyPlayers is returned by UpdateRoom if the max players is below
+	// the number of players already in the room.
+	ErrTooManyPlayers = errors.New("More players in the room than max players")
+)
+
+// RoomSettings are the settings of a room its owner can change. The ready
+// policy, the privacy and the password of the room are selected by its
+// options.
+type RoomSettings struct {
+	Name       string
+	Options    *proto_lobby.RoomOptions
+	MaxPlayers uint
+}
+
+// Settings returns the current settings of the room.
+func (r *Room) Settings() RoomSettings {
+	var settings RoomSettings
+	r.do(func() error {
+		settings = RoomSettings{
+			Name:       r.name,
+			Options:    r.options,
+			MaxPlayers: r.maxPlayers,
+		}
+		return nil
+	})
+	return settings
+}
+
+// Update changes the settings of the room, it returns false if they are the
+// same as before. Settings can't change once the game is in progress. A ready
+// check in progress is cancelled if anything other than the name changes
+// because the players confirmed they are ready to play with the old settings.
+func (r *Room) Update(settings RoomSettings) (bool, error) {
+	changed := false
+	err := r.do(func() error {
+		if r.status == inProgress {
+			return ErrGameInProgress
+		}
+		if settings.MaxPlayers < r.numPlayers() {
+			return ErrTooManyPlayers
+		}
+		if settings.Name != r.name {
+			r.name = settings.Name
+			changed = true
+		}
+		if settings.MaxPlayers == r.maxPlayers && pbuf.Equal(settings.Options, r.options) {
+			return nil
+		}
+		r.options = settings.Options
+		r.maxPlayers = settings.MaxPlayers
+		r.readyPolicy = ReadyPolicyFromOptions(settings.Options)
+		changed = true
+		if r.status == starting {
+			r.reset()
+			r.pending.readyCheck = append(r.pending.readyCheck, ReadyCheckChange{
+				Status: ReadyCheckCancelled,
+			})
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// UpdateRoom changes the name and the options of the room if it is at the
+// expected version and returns the updated room. An empty name or nil
+// options keep the current ones. The name is checked like the name of a new
+// room. The options replace the current options as a whole, including the
+// privacy and the password, and their max players, if set, becomes the
+// room's max players.
+func (r *RoomList) UpdateRoom(
+	userId user.Id,
+	roomId RoomId,
+	name string,
+	options *proto_lobby.RoomOptions,
+	expectedVersion uint64) (*proto_lobby.Room, error) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room, err := r.managedRoom(userId, roomId, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	settings := room.Settings()
+	if name != "" {
+		limits := r.GetLimits()
+		if settings.Name, err = NormalizeRoomName(name, limits.MaxNameLength, r.BlocksName); err != nil {
+			return nil, err
+		}
+	}
+	if options != nil {
+		settings.Options = options
+		if options.MaxPlayers != nil {
+			settings.MaxPlayers = uint(options.GetMaxPlayers())
+			if !validMaxPlayers(settings.MaxPlayers, r.GetLimits()) {
+				return nil, ErrInvalidMaxPlayers
+			}
+		}
+	}
+	changed, err := room.Update(settings)
+	if err != nil {
+		return nil, err
+	}
+	roomProto := room.Proto()
+	if changed {
+		log.Printf("User [id=%s] updated room [id=%s]", userId, room.GetId())
+		r.touchRoom(room)
+		r.notifyAsync(&proto_lobby.RoomUpdatedEvent{
+			Room: roomProto,
+		}, room.GetUserIds()...)
+	}
+	return roomProto, nil
+}
+
+// validMaxPlayers returns true if rooms can have maxPlayers players.
+func validMaxPlayers(maxPlayers uint, limits Limits) bool {
+	return maxPlayers > 0 && maxPlayers <= limits.MaxPlayers
+}
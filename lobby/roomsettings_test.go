@@ -0,0 +1,138 @@
+package lobby_test
+
+import (
+	"testing"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+func TestUpdateRoomChangesNameAndOptions(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	options := &proto_lobby.RoomOptions{
+		MaxPlayers:  pbuf.Uint32(2),
+		ReadyPolicy: proto_lobby.RoomOptions_OWNER_FORCE.Enum(),
+	}
+	updated, err := roomList.UpdateRoom("1", lobby.OwnRoom, "renamed", options, lobby.AnyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed", updated.GetName())
+	assert.Equal(t, options, updated.GetOptions())
+	assert.True(t, updated.GetVersion() > room.GetVersion())
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.RoomUpdatedEventMessage))
+
+	_, errCode := roomList.JoinRoom("3", lobby.RoomId(room.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_ROOM_FULL, errCode, "Max players comes from the options")
+
+	_, err = roomList.UpdateRoom("1", lobby.OwnRoom, "renamed", nil, lobby.AnyVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.RoomUpdatedEventMessage), "Nothing changed")
+	_, err = roomList.UpdateRoom("2", lobby.OwnRoom, "other", nil, lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrNotOwner, err)
+}
+
+func TestUpdateRoomChecksMaxPlayers(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.JoinRoom("3", lobby.RoomId(room.GetId()))
+
+	_, err := roomList.UpdateRoom("1", lobby.OwnRoom, "", &proto_lobby.RoomOptions{MaxPlayers: pbuf.Uint32(2)}, lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrTooManyPlayers, err)
+	limit := uint32(roomList.GetLimits().MaxPlayers)
+	_, err = roomList.UpdateRoom("1", lobby.OwnRoom, "", &proto_lobby.RoomOptions{MaxPlayers: pbuf.Uint32(limit + 1)}, lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrInvalidMaxPlayers, err)
+	_, err = roomList.UpdateRoom("1", lobby.OwnRoom, "", &proto_lobby.RoomOptions{MaxPlayers: pbuf.Uint32(3)}, lobby.AnyVersion)
+	assert.NoError(t, err)
+}
+
+func TestUpdateRoomCancelsReadyCheck(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+
+	roomList.UpdateRoom("1", lobby.OwnRoom, "renamed", nil, lobby.AnyVersion)
+	status, _ := roomList.GetMyRoom("2")
+	assert.True(t, status.Starting, "Changing the name keeps the ready check")
+
+	roomList.UpdateRoom("1", lobby.OwnRoom, "", &proto_lobby.RoomOptions{
+		ReadyPolicy: proto_lobby.RoomOptions_QUORUM.Enum(),
+	}, lobby.AnyVersion)
+	status, _ = roomList.GetMyRoom("2")
+	assert.False(t, status.Starting)
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.ReadyCheckCancelledEventMessage))
+}
+
+func TestUpdateRoomRejectsGameInProgressAndStaleVersion(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+
+	_, err := roomList.UpdateRoom("1", lobby.OwnRoom, "renamed", nil, room.GetVersion())
+	assert.Equal(t, lobby.ErrVersionConflict, err)
+
+	roomList.LeaveRoom("2")
+	roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion)
+	_, err = roomList.UpdateRoom("1", lobby.OwnRoom, "renamed", nil, lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrGameInProgress, err)
+}
+
+func TestCreateRoomAppliesMaxPlayers(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, errCode := roomList.CreateRoom("1", "room", &proto_lobby.RoomOptions{MaxPlayers: pbuf.Uint32(2)})
+	assert.Equal(t, proto_lobby.CreateRoomResponse_ErrorCode(0), errCode)
+	roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	_, joinCode := roomList.JoinRoom("3", lobby.RoomId(room.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_ROOM_FULL, joinCode)
+
+	limit := uint32(roomList.GetLimits().MaxPlayers)
+	_, errCode = roomList.CreateRoom("4", "room", &proto_lobby.RoomOptions{MaxPlayers: pbuf.Uint32(limit + 1)})
+	assert.Equal(t, proto_lobby.CreateRoomResponse_INVALID_MAX_PLAYERS, errCode)
+	_, errCode = roomList.CreateRoom("4", "room", &proto_lobby.RoomOptions{MaxPlayers: pbuf.Uint32(0)})
+	assert.Equal(t, proto_lobby.CreateRoomResponse_INVALID_MAX_PLAYERS, errCode)
+}
+
+func TestRoomPasswordIsCheckedAndNotShown(t *testing.T) {
+	roomList, _, _ := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", &proto_lobby.RoomOptions{Password: pbuf.String("secret")})
+	assert.Nil(t, room.GetOptions().Password)
+	assert.True(t, room.GetHasPassword())
+
+	_, errCode := roomList.JoinRoom("2", lobby.RoomId(room.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_WRONG_PASSWORD, errCode)
+	_, errCode = roomList.JoinRoomWithPassword("2", lobby.RoomId(room.GetId()), "wrong")
+	assert.Equal(t, proto_lobby.JoinRoomResponse_WRONG_PASSWORD, errCode)
+	joined, _ := roomList.JoinRoomWithPassword("2", lobby.RoomId(room.GetId()), "secret")
+	if assert.NotNil(t, joined) {
+		assert.Nil(t, joined.GetOptions().Password)
+	}
+
+	updated, err := roomList.UpdateRoom("1", lobby.OwnRoom, "", &proto_lobby.RoomOptions{}, lobby.AnyVersion)
+	assert.NoError(t, err)
+	assert.False(t, updated.GetHasPassword())
+	_, errCode = roomList.JoinRoom("3", lobby.RoomId(room.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_ErrorCode(0), errCode, "Removing the password opens the room")
+}
+
+func TestPrivateRoomsAreNotListed(t *testing.T) {
+	roomList, _, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", &proto_lobby.RoomOptions{Private: pbuf.Bool(true)})
+	roomList.CreateRoom("2", "public", nil)
+
+	rooms := roomList.ListRoomsExcluding("3")
+	if assert.Len(t, rooms, 1) {
+		assert.Equal(t, "public", rooms[0].GetName())
+	}
+	joined, _ := roomList.JoinRoom("3", lobby.RoomId(room.GetId()))
+	assert.NotNil(t, joined, "Private rooms are joined by id")
+
+	roomList.UpdateRoom("1", lobby.OwnRoom, "", &proto_lobby.RoomOptions{Private: pbuf.Bool(false)}, lobby.AnyVersion)
+	assert.Len(t, roomList.ListRoomsExcluding("4"), 2)
+	assert.Equal(t, 2, countEvents(events(), proto_lobby.RoomCreatedEventMessage))
+}
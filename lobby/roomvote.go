@@ -0,0 +1,347 @@
+package lobby
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+)
+
+var (
+	ErrVoteInProgress = errors.New("Vote already in progress in the room")
+	// ErrNoVote is returned by CastVote if the vote is not in progress in
+	// the user's room.
+	ErrNoVote = errors.New("No such vote in progress")
+	// ErrInvalidVoteTarget is returned by StartVote if the player to kick or
+	// to make the owner is not in the room, is the user starting a vote to
+	// kick or already owns the room.
+	ErrInvalidVoteTarget = errors.New("Invalid vote target")
+	// ErrNotEnoughVoters is returned by StartVote if a room has too few
+	// members to vote to kick one of them.
+	ErrNotEnoughVoters = errors.New("Not enough voters")
+)
+
+// minKickVoters is the number of members besides the player to kick that must
+// vote yes to kick them, so no member can kick another alone.
+const minKickVoters = 2
+
+// VoteKind is the decision the members of a room vote on.
+type VoteKind int
+
+const (
+	// VoteKick removes the target from the room.
+	VoteKick VoteKind = iota
+	// VoteStart starts the game like the owner would.
+	VoteStart
+	// VoteTransferOwnership makes the target the owner of the room.
+	VoteTransferOwnership
+)
+
+// VoteKindFromProto returns the vote kind matching the protobuf vote kind.
+func VoteKindFromProto(kind proto_lobby.Vote_Kind) VoteKind {
+	switch kind {
+	case proto_lobby.Vote_START:
+		return VoteStart
+	case proto_lobby.Vote_TRANSFER_OWNERSHIP:
+		return VoteTransferOwnership
+	}
+	return VoteKick
+}
+
+func (k VoteKind) proto() proto_lobby.Vote_Kind {
+	switch k {
+	case VoteStart:
+		return proto_lobby.Vote_START
+	case VoteTransferOwnership:
+		return proto_lobby.Vote_TRANSFER_OWNERSHIP
+	}
+	return proto_lobby.Vote_KICK
+}
+
+// roomVote is the vote in progress in a room. Like the chat it is kept by the
+// RoomList apart from the room so voting does not change the room's version.
+type roomVote struct {
+	kind      VoteKind
+	target    user.Id
+	startedBy user.Id
+	votes     *PlayersVote
+}
+
+// StartVote starts a vote of the members of the user's room if it is at the
+// expected version, the user's own vote counts as yes. Everyone in the room
+// except the player to kick can vote. The vote passes once VoteThreshold
+// percent of them voted yes and fails if they don't before VoteTimeout ends.
+// Kicking a player takes the yes votes of at least two other members.
+// A room has at most one vote in progress.
+func (r *RoomList) StartVote(
+	userId user.Id,
+	kind VoteKind,
+	target user.Id,
+	expectedVersion uint64) (*proto_lobby.Vote, error) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[r.players[userId]]
+	if room == nil {
+		return nil, ErrNotInRoom
+	}
+	if err := checkVersion(room, expectedVersion); err != nil {
+		return nil, err
+	}
+	if r.votes[room.GetId()] != nil {
+		return nil, ErrVoteInProgress
+	}
+	voters := room.GetUserIds()
+	switch kind {
+	case VoteKick:
+		if target == userId || r.players[target] != room.GetId() {
+			return nil, ErrInvalidVoteTarget
+		}
+		voters = excludeUser(voters, target)
+		if len(voters) < minKickVoters {
+			return nil, ErrNotEnoughVoters
+		}
+	case VoteStart:
+		if room.IsStarting() {
+			return nil, ErrGameStartInProgress
+		}
+		if room.IsStarted() {
+			return nil, ErrAlreadyStarted
+		}
+		target = ""
+	case VoteTransferOwnership:
+		if target == room.GetOwner() || r.players[target] != room.GetId() {
+			return nil, ErrInvalidVoteTarget
+		}
+	}
+	limits := r.GetLimits()
+	vote := &roomVote{
+		kind:      kind,
+		target:    target,
+		startedBy: userId,
+		votes:     NewPlayersVote(voters, limits.VoteThreshold),
+	}
+	vote.votes.Clock = r.scheduler
+	if kind == VoteKick {
+		vote.votes.MinYes = minKickVoters
+	}
+	vote.votes.Start(limits.VoteTimeout, func(voteId string) {
+		r.voteTimedOut(room, voteId)
+	})
+	vote.votes.Vote(userId, true)
+	r.votes[room.GetId()] = vote
+	log.Printf("User [id=%s] started a vote [id=%s] in room [id=%s]", userId, vote.votes.GetId(), room.GetId())
+	r.touchRoom(room)
+	voteProto := vote.proto()
+	r.notifyAsync(&proto_lobby.VoteStartedEvent{
+		RoomId: pbuf.String(room.GetId().String()),
+		Vote:   voteProto,
+	}, room.GetUserIds()...)
+	r.voteDecided(room, vote)
+	return voteProto, nil
+}
+
+// CastVote records the user's vote in the vote with the id in their room and
+// returns the vote. The vote ends if this decides it.
+func (r *RoomList) CastVote(userId user.Id, voteId string, yes bool) (*proto_lobby.Vote, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	room := r.rooms[r.players[userId]]
+	if room == nil {
+		return nil, ErrNotInRoom
+	}
+	vote := r.votes[room.GetId()]
+	if vote == nil || vote.votes.GetId() != voteId {
+		return nil, ErrNoVote
+	}
+	if err := vote.votes.Vote(userId, yes); err == ErrVoteEnded {
+		// The timeout ended the vote and is waiting for the list's lock.
+		return nil, ErrNoVote
+	} else if err != nil {
+		return nil, err
+	}
+	log.Printf("User [id=%s] voted %t in vote [id=%s] in room [id=%s]", userId, yes, voteId, room.GetId())
+	r.touchRoom(room)
+	voteProto := vote.proto()
+	r.notifyAsync(&proto_lobby.VoteProgressEvent{
+		RoomId: pbuf.String(room.GetId().String()),
+		Vote:   voteProto,
+	}, room.GetUserIds()...)
+	r.voteDecided(room, vote)
+	return voteProto, nil
+}
+
+// voteDecided carries out the vote if it passed and ends it if it was
+// decided.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) voteDecided(room *Room, vote *roomVote) {
+	switch vote.votes.Result() {
+	case VotePassed:
+		// The vote ends first so the changes made by it don't affect it.
+		r.stopVote(room.GetId())
+		result := proto_lobby.VoteEndedEvent_PASSED
+		if err := r.carryOut(room, vote); err != nil {
+			log.Printf("Vote [id=%s] in room [id=%s] passed but failed: %s", vote.votes.GetId(), room.GetId(), err)
+			result = proto_lobby.VoteEndedEvent_CANCELLED
+		}
+		r.endVote(room, vote, result)
+	case VoteFailed:
+		r.endVote(room, vote, proto_lobby.VoteEndedEvent_FAILED)
+	}
+}
+
+// carryOut makes the change the members of the room voted for.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) carryOut(room *Room, vote *roomVote) error {
+	switch vote.kind {
+	case VoteKick:
+		if room.CancelStart() == nil {
+			log.Printf("Cancelled the start of the game in room [id=%s] to kick user [id=%s]", room.GetId(), vote.target)
+		}
+		log.Printf("Kicking user [id=%s] from room [id=%s] by vote", vote.target, room.GetId())
+		if err := r.leave(room, vote.target); err != nil {
+			return err
+		}
+		r.kick(room, vote.target, r.GetLimits().KickCooldown)
+		r.notifyAsync(&proto_lobby.PlayerRemovedEvent{
+			RoomId: pbuf.String(room.GetId().String()),
+			Player: pbuf.String(vote.target.String()),
+			Reason: proto_lobby.PlayerRemovedEvent_VOTE_KICKED.Enum(),
+		}, vote.target)
+	case VoteStart:
+		log.Printf("Starting the game in room [id=%s] by vote", room.GetId())
+		userState, err := room.StartGame()
+		if err != nil {
+			return err
+		}
+		r.notifyGameStart(room, userState)
+	case VoteTransferOwnership:
+		log.Printf("Transferring room [id=%s] to user [id=%s] by vote", room.GetId(), vote.target)
+		if err := room.TransferOwnership(vote.target); err != nil {
+			return err
+		}
+		r.notifyAsync(&proto_lobby.RoomUpdatedEvent{
+			Room: room.Proto(),
+		}, room.GetUserIds()...)
+	}
+	r.touchRoom(room)
+	return nil
+}
+
+// kick keeps the user from joining the room again until the cooldown ends, a
+// zero cooldown lets them join right away.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) kick(room *Room, userId user.Id, cooldown time.Duration) {
+	if cooldown <= 0 || r.rooms[room.GetId()] == nil {
+		return
+	}
+	kicked := r.kicked[room.GetId()]
+	if kicked == nil {
+		kicked = make(map[user.Id]time.Time)
+		r.kicked[room.GetId()] = kicked
+	}
+	kicked[userId] = r.scheduler.Now().Add(cooldown)
+}
+
+// isKicked checks if the user was kicked from the room and can't join it
+// yet. Expired kicks are forgotten.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) isKicked(roomId RoomId, userId user.Id) bool {
+	until, ok := r.kicked[roomId][userId]
+	if !ok {
+		return false
+	}
+	if r.scheduler.Now().Before(until) {
+		return true
+	}
+	delete(r.kicked[roomId], userId)
+	if len(r.kicked[roomId]) == 0 {
+		delete(r.kicked, roomId)
+	}
+	return false
+}
+
+// endVote removes the vote from the room and notifies its members about the
+// result.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) endVote(room *Room, vote *roomVote, result proto_lobby.VoteEndedEvent_Result) {
+	r.stopVote(room.GetId())
+	log.Printf("Vote [id=%s] in room [id=%s] ended: %s", vote.votes.GetId(), room.GetId(), result)
+	r.notifyAsync(&proto_lobby.VoteEndedEvent{
+		RoomId: pbuf.String(room.GetId().String()),
+		Vote:   vote.proto(),
+		Result: result.Enum(),
+	}, room.GetUserIds()...)
+}
+
+// stopVote stops the timeout of the vote in the room and removes it.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) stopVote(roomId RoomId) {
+	if vote := r.votes[roomId]; vote != nil {
+		vote.votes.Cancel()
+		delete(r.votes, roomId)
+	}
+}
+
+// voteTimedOut ends the vote if it is still in progress when its timeout
+// ends.
+func (r *RoomList) voteTimedOut(room *Room, voteId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	vote := r.votes[room.GetId()]
+	if vote == nil || vote.votes.GetId() != voteId {
+		return
+	}
+	log.Printf("Vote [id=%s] in room [id=%s] timed out", voteId, room.GetId())
+	r.endVote(room, vote, proto_lobby.VoteEndedEvent_FAILED)
+}
+
+// memberLeft updates the vote in the room after the user left it. The vote is
+// cancelled if the user was its target, otherwise the user no longer votes.
+// This method should only be called while owning the list's lock.
+func (r *RoomList) memberLeft(room *Room, userId user.Id) {
+	vote := r.votes[room.GetId()]
+	if vote == nil {
+		return
+	}
+	if vote.target == userId {
+		r.endVote(room, vote, proto_lobby.VoteEndedEvent_CANCELLED)
+		return
+	}
+	if vote.votes.HasUser(userId) {
+		vote.votes.RemoveVoter(userId)
+		r.voteDecided(room, vote)
+	}
+}
+
+// currentVote returns the vote in progress in the room or nil if there is none.
+func (r *RoomList) currentVote(roomId RoomId) *proto_lobby.Vote {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if vote := r.votes[roomId]; vote != nil {
+		return vote.proto()
+	}
+	return nil
+}
+
+// proto returns the protobuf representation of the vote.
+func (v *roomVote) proto() *proto_lobby.Vote {
+	msg := &proto_lobby.Vote{
+		Id:          pbuf.String(v.votes.GetId()),
+		Kind:        v.kind.proto().Enum(),
+		StartedBy:   pbuf.String(v.startedBy.String()),
+		Deadline:    pbuf.Int64(v.votes.Deadline().UnixNano() / int64(time.Millisecond)),
+		VotesNeeded: pbuf.Uint32(uint32(v.votes.Needed())),
+		Voters:      toStringSlice(v.votes.Voters()),
+		Yes:         toStringSlice(v.votes.Yes()),
+		No:          toStringSlice(v.votes.No()),
+	}
+	if v.target != "" {
+		msg.Target = pbuf.String(v.target.String())
+	}
+	return msg
+}
@@ -0,0 +1,189 @@
+package lobby_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// makeVoteRoom returns a room list with a room owned by user 1 that users 2
+// up to members joined, its clock and a function returning the events.
+func makeVoteRoom(members int) (*lobby.RoomList, *proto_lobby.Room, *util.FakeClock, func() []proto.ProtobufMessage) {
+	roomList, clock, events := makeRoomList()
+	room, _ := roomList.CreateRoom("1", "room", nil)
+	for i := 2; i <= members; i++ {
+		roomList.JoinRoom(user.Id(fmt.Sprint(i)), lobby.RoomId(room.GetId()))
+	}
+	return roomList, roomList.GetRoom(lobby.RoomId(room.GetId())), clock, events
+}
+
+func voteResult(events []proto.ProtobufMessage) proto_lobby.VoteEndedEvent_Result {
+	event := lastEvent(events, proto_lobby.VoteEndedEventMessage)
+	if event == nil {
+		return -1
+	}
+	return event.(*proto_lobby.VoteEndedEvent).GetResult()
+}
+
+func TestMembersCanVoteToKick(t *testing.T) {
+	roomList, room, clock, events := makeVoteRoom(3)
+
+	vote, err := roomList.StartVote("2", lobby.VoteKick, "1", lobby.AnyVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"2", "3"}, vote.GetVoters())
+	assert.Equal(t, uint32(2), vote.GetVotesNeeded())
+	assert.Equal(t, 1, countEvents(events(), proto_lobby.VoteStartedEventMessage))
+
+	_, err = roomList.CastVote("1", vote.GetId(), false)
+	assert.Equal(t, lobby.ErrUnknownUser, err, "The player to kick can't vote")
+	_, err = roomList.CastVote("3", vote.GetId(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, proto_lobby.VoteEndedEvent_PASSED, voteResult(events()))
+	_, err = roomList.GetMyRoom("1")
+	assert.Equal(t, lobby.ErrNotInRoom, err)
+	assert.NoError(t, roomList.CheckInvariants())
+
+	_, errCode := roomList.JoinRoom("1", lobby.RoomId(room.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_KICKED, errCode, "Kicked players can't join again right away")
+	clock.Advance(roomList.GetLimits().KickCooldown)
+	_, errCode = roomList.JoinRoom("1", lobby.RoomId(room.GetId()))
+	assert.Equal(t, proto_lobby.JoinRoomResponse_ErrorCode(0), errCode)
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+func TestKickNeedsTwoVoters(t *testing.T) {
+	roomList, _, _, _ := makeVoteRoom(2)
+
+	_, err := roomList.StartVote("2", lobby.VoteKick, "1", lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrNotEnoughVoters, err)
+	status, _ := roomList.GetMyRoom("1")
+	assert.Nil(t, status.Vote)
+}
+
+func TestMemberCantKickAlone(t *testing.T) {
+	roomList, _, _, events := makeVoteRoom(3)
+	limits := roomList.GetLimits()
+	limits.VoteThreshold = 50
+	roomList.SetLimits(limits)
+
+	vote, err := roomList.StartVote("2", lobby.VoteKick, "1", lobby.AnyVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint32(2), vote.GetVotesNeeded())
+	assert.Equal(t, proto_lobby.VoteEndedEvent_Result(-1), voteResult(events()), "The vote is still in progress")
+	_, err = roomList.GetMyRoom("1")
+	assert.NoError(t, err)
+
+	_, err = roomList.CastVote("3", vote.GetId(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, proto_lobby.VoteEndedEvent_FAILED, voteResult(events()))
+	_, err = roomList.GetMyRoom("1")
+	assert.NoError(t, err)
+}
+
+func TestMembersCanVoteToTransferOwnership(t *testing.T) {
+	roomList, room, _, _ := makeVoteRoom(3)
+
+	vote, err := roomList.StartVote("2", lobby.VoteTransferOwnership, "3", room.GetVersion())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = roomList.CastVote("3", vote.GetId(), true)
+	assert.NoError(t, err)
+	updated := roomList.GetRoom(lobby.RoomId(room.GetId()))
+	assert.Equal(t, "3", updated.GetOwner())
+	assert.Contains(t, updated.GetPlayers(), "1")
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+func TestPassedVoteIsCancelledIfItCantBeCarriedOut(t *testing.T) {
+	roomList, room, _, events := makeVoteRoom(3)
+
+	vote, err := roomList.StartVote("2", lobby.VoteTransferOwnership, "3", lobby.AnyVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion))
+	_, err = roomList.CastVote("3", vote.GetId(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, proto_lobby.VoteEndedEvent_CANCELLED, voteResult(events()))
+	assert.Equal(t, "1", roomList.GetRoom(lobby.RoomId(room.GetId())).GetOwner())
+	status, _ := roomList.GetMyRoom("2")
+	assert.Nil(t, status.Vote)
+}
+
+func TestVoterLeavingCanDecideVote(t *testing.T) {
+	roomList, room, _, events := makeVoteRoom(4)
+
+	vote, err := roomList.StartVote("2", lobby.VoteTransferOwnership, "4", lobby.AnyVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint32(3), vote.GetVotesNeeded())
+	_, err = roomList.CastVote("4", vote.GetId(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, proto_lobby.VoteEndedEvent_Result(-1), voteResult(events()))
+
+	roomList.LeaveRoom("3")
+	assert.Equal(t, proto_lobby.VoteEndedEvent_PASSED, voteResult(events()))
+	assert.Equal(t, "4", roomList.GetRoom(lobby.RoomId(room.GetId())).GetOwner())
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+func TestVoteToStartFailsOnTimeout(t *testing.T) {
+	roomList, _, clock, events := makeVoteRoom(3)
+
+	vote, err := roomList.StartVote("2", lobby.VoteStart, "", lobby.AnyVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = roomList.StartVote("3", lobby.VoteStart, "", lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrVoteInProgress, err)
+
+	clock.Advance(roomList.GetLimits().VoteTimeout)
+	assert.Equal(t, proto_lobby.VoteEndedEvent_FAILED, voteResult(events()))
+	_, err = roomList.CastVote("3", vote.GetId(), true)
+	assert.Equal(t, lobby.ErrNoVote, err)
+	status, _ := roomList.GetMyRoom("2")
+	assert.False(t, status.Starting)
+}
+
+func TestVoteIsCancelledWhenTargetLeaves(t *testing.T) {
+	roomList, _, _, events := makeVoteRoom(3)
+	vote, _ := roomList.StartVote("2", lobby.VoteKick, "3", lobby.AnyVersion)
+
+	roomList.LeaveRoom("3")
+	assert.Equal(t, proto_lobby.VoteEndedEvent_CANCELLED, voteResult(events()))
+	_, err := roomList.CastVote("1", vote.GetId(), true)
+	assert.Equal(t, lobby.ErrNoVote, err)
+	assert.NoError(t, roomList.CheckInvariants())
+}
+
+func TestStartVoteChecks(t *testing.T) {
+	roomList, room, _, _ := makeVoteRoom(3)
+
+	_, err := roomList.StartVote("4", lobby.VoteStart, "", lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrNotInRoom, err)
+	_, err = roomList.StartVote("2", lobby.VoteKick, "2", lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrInvalidVoteTarget, err)
+	_, err = roomList.StartVote("2", lobby.VoteKick, user.Id("4"), lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrInvalidVoteTarget, err)
+	_, err = roomList.StartVote("2", lobby.VoteTransferOwnership, "1", lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrInvalidVoteTarget, err)
+	_, err = roomList.StartVote("2", lobby.VoteStart, "", room.GetVersion()-1)
+	assert.Equal(t, lobby.ErrVersionConflict, err)
+
+	assert.NoError(t, roomList.StartGame("1", lobby.OwnRoom, lobby.AnyVersion))
+	_, err = roomList.StartVote("2", lobby.VoteStart, "", lobby.AnyVersion)
+	assert.Equal(t, lobby.ErrGameStartInProgress, err)
+}
@@ -0,0 +1,44 @@
+package lobby
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// versions hands out increasing versions. The rooms of a RoomList share one
+// so any change to the list or its rooms results in a version greater than
+// all the previous ones.
+type versions struct {
+	// last is the version of the last change that was published.
+	last uint64
+	lock *sync.Mutex
+}
+
+// newVersions returns versions starting at the current time in microseconds.
+// Versions clients got before a restart are then smaller than all versions
+// handed out after it, as long as there was less than one change per
+// microsecond. Microseconds keep versions exact in JSON numbers.
+func newVersions() *versions {
+	return &versions{
+		last: uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+		lock: new(sync.Mutex),
+	}
+}
+
+// publish calls store with the next version. Changes are stored in the order
+// of their versions and last is only updated after the change is stored, so
+// a reader that loads last before the published changes sees every change up
+// to that version.
+func (v *versions) publish(store func(version uint64)) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	version := v.last + 1
+	store(version)
+	atomic.StoreUint64(&v.last, version)
+}
+
+// current returns the version of the last published change.
+func (v *versions) current() uint64 {
+	return atomic.LoadUint64(&v.last)
+}
@@ -3,18 +3,26 @@ package main
 import (
 	"flag"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"syscall"
 
 	"github.com/opentarock/service-api/go/client"
 	nservice "github.com/opentarock/service-api/go/service"
 
+	"github.com/opentarock/service-api/go/proto"
 	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/lobby"
 	"github.com/opentarock/service-lobby/service"
 )
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
+var configFile = flag.String("config", "", "path to JSON configuration file")
 
 func main() {
 	flag.Parse()
@@ -30,29 +38,156 @@ func main() {
 
 	log.SetFlags(log.Ldate | log.Lmicroseconds)
 
-	lobbyService := nservice.NewRepService("tcp://*:7001")
+	conf, err := config.NewManager(*configFile)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %s", err)
+	}
+
+	lobbyService := nservice.NewRepService(conf.Get().ServiceAddress)
 
 	notifyClient := client.NewNotifyClientNanomsg()
-	notifyClient.Connect("tcp://localhost:8001")
+	notifyClient.Connect(conf.Get().NotifyAddress)
 	defer notifyClient.Close()
 
-	handlers := service.NewLobbyServiceHandlers(notifyClient)
-	lobbyService.AddHandler(proto_lobby.CreateRoomRequestMessage, handlers.CreateRoomHandler())
-	lobbyService.AddHandler(proto_lobby.JoinRoomRequestMessage, handlers.JoinRoomHandler())
-	lobbyService.AddHandler(proto_lobby.LeaveRoomRequestMessage, handlers.LeaveRoomHandler())
-	lobbyService.AddHandler(proto_lobby.ListRoomsRequestMessage, handlers.ListRoomsHandler())
-	lobbyService.AddHandler(proto_lobby.RoomInfoRequestMessage, handlers.RoomInfoHandler())
-	lobbyService.AddHandler(proto_lobby.StartGameRequestMessage, handlers.StartGameHandler())
-	lobbyService.AddHandler(proto_lobby.PlayerReadyRequestMessage, handlers.PlayerReadyHandler())
+	handlers := service.NewLobbyServiceHandlers(notifyClient, conf)
+	if path := conf.Get().AuditLog; path != "" {
+		auditFile, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			log.Fatalf("Error opening audit log: %s", err)
+		}
+		defer auditFile.Close()
+		handlers.SetAuditLog(service.NewJsonAuditLog(auditFile))
+	}
+	if path := conf.Get().WordList; path != "" {
+		words, err := lobby.LoadWordList(path)
+		if err != nil {
+			log.Fatalf("Error loading word list: %s", err)
+		}
+		handlers.SetNameFilter(words.Blocks)
+		handlers.SetMessageModerator(func(userId user.Id, roomId lobby.RoomId, text string) (string, bool) {
+			return text, !words.Blocks(text)
+		})
+	}
+	// Every request is subject to the rate limits.
+	lobbyHandlers := map[proto.Type]nservice.MessageHandler{
+		proto_lobby.CreateRoomRequestMessage:      handlers.CreateRoomHandler(),
+		proto_lobby.JoinRoomRequestMessage:        handlers.JoinRoomHandler(),
+		proto_lobby.LeaveRoomRequestMessage:       handlers.LeaveRoomHandler(),
+		proto_lobby.ListRoomsRequestMessage:       handlers.ListRoomsHandler(),
+		proto_lobby.RoomInfoRequestMessage:        handlers.RoomInfoHandler(),
+		proto_lobby.StartGameRequestMessage:       handlers.StartGameHandler(),
+		proto_lobby.PlayerReadyRequestMessage:     handlers.PlayerReadyHandler(),
+		proto_lobby.ForceStartGameRequestMessage:  handlers.ForceStartGameHandler(),
+		proto_lobby.CancelStartRequestMessage:     handlers.CancelStartHandler(),
+		proto_lobby.UpdateRoomRequestMessage:      handlers.UpdateRoomHandler(),
+		proto_lobby.SendRoomMessageRequestMessage: handlers.SendRoomMessageHandler(),
+		proto_lobby.MuteMemberRequestMessage:      handlers.MuteMemberHandler(),
+		proto_lobby.StartVoteRequestMessage:       handlers.StartVoteHandler(),
+		proto_lobby.CastVoteRequestMessage:        handlers.CastVoteHandler(),
+		proto_lobby.GetMyRoomRequestMessage:       handlers.GetMyRoomHandler(),
+		proto_lobby.HeartbeatRequestMessage:       handlers.HeartbeatHandler(),
+		proto_lobby.ReloadConfigRequestMessage:    handlers.ReloadConfigHandler(),
+		// Admin requests.
+		proto_lobby.AdminListRoomsRequestMessage:    handlers.AdminListRoomsHandler(),
+		proto_lobby.AdminCloseRoomRequestMessage:    handlers.AdminCloseRoomHandler(),
+		proto_lobby.AdminRemovePlayerRequestMessage: handlers.AdminRemovePlayerHandler(),
+		proto_lobby.AdminCancelStartRequestMessage:  handlers.AdminCancelStartHandler(),
+		proto_lobby.AdminMovePlayerRequestMessage:   handlers.AdminMovePlayerHandler(),
+	}
+	for msgType, handler := range lobbyHandlers {
+		lobbyService.AddHandler(msgType, handlers.RateLimited(msgType, handler))
+	}
 
-	err := lobbyService.Start()
+	err = lobbyService.Start()
 	if err != nil {
 		log.Fatalf("Error starting lobby service: %s", err)
 	}
 	defer lobbyService.Close()
 
+	var tokens *service.AccessTokens
+	if path := conf.Get().AccessTokens; path != "" {
+		tokens, err = service.LoadAccessTokens(path)
+		if err != nil {
+			log.Fatalf("Error loading access tokens: %s", err)
+		}
+	}
+	var auth service.Authenticator
+	if c := conf.Get(); c.HttpAddress != "" || c.GrpcAddress != "" {
+		auth = gatewayAuthenticator(c, tokens)
+	}
+
+	if addr := conf.Get().HttpAddress; addr != "" {
+		httpServer := &http.Server{
+			Addr:    addr,
+			Handler: service.NewHttpHandler(handlers, auth),
+		}
+		go func() {
+			err := httpServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error starting HTTP gateway: %s", err)
+			}
+		}()
+		defer httpServer.Close()
+	}
+
+	if addr := conf.Get().WebsocketAddress; addr != "" {
+		// Browsers can't set headers on WebSocket requests so users always
+		// authenticate with their access token.
+		gateway := service.NewWebsocketGateway(handlers, service.BearerAuthenticator{Lookup: tokens.Lookup})
+		gateway.AllowedOrigins = conf.Get().WebsocketOrigins
+		defer gateway.Close()
+		websocketServer := &http.Server{
+			Addr:    addr,
+			Handler: gateway,
+		}
+		go func() {
+			err := websocketServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error starting WebSocket gateway: %s", err)
+			}
+		}()
+		defer websocketServer.Close()
+	}
+
+	if addr := conf.Get().GrpcAddress; addr != "" {
+		grpcServer := service.NewGrpcServer(handlers, auth)
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Error starting gRPC server: %s", err)
+		}
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Printf("gRPC server stopped: %s", err)
+			}
+		}()
+		defer grpcServer.Stop()
+	}
+
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	sig := <-c
-	log.Printf("Interrupted by %s", sig)
+	signal.Notify(c, os.Interrupt, syscall.SIGHUP)
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			log.Printf("Interrupted by %s", sig)
+			break
+		}
+		restart, err := conf.Reload()
+		if err != nil {
+			log.Printf("Error reloading configuration: %s", err)
+		} else if len(restart) > 0 {
+			log.Printf("Configuration reloaded, restart required for: %v", restart)
+		} else {
+			log.Printf("Configuration reloaded")
+		}
+	}
+}
+
+// gatewayAuthenticator returns the authenticator identifying the users of the
+// HTTP and gRPC gateways. Users authenticate with bearer tokens unless the
+// configuration opts in to trusting a header set by a proxy.
+func gatewayAuthenticator(c *config.Config, tokens *service.AccessTokens) service.Authenticator {
+	if c.HttpUserHeader != "" {
+		log.Printf("Trusting the %s header to identify users, the gateways must only be reachable through the proxy setting it", c.HttpUserHeader)
+		return service.HeaderAuthenticator{Header: c.HttpUserHeader}
+	}
+	return service.BearerAuthenticator{Lookup: tokens.Lookup}
 }
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// Admin operations let the operators manage any room. They require
+// authz.PermissionAdmin and every one of them is written to the audit log.
+
+func (s *lobbyServiceHandlers) adminListRooms(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.AdminListRoomsRequest) (*proto_lobby.AdminListRoomsResponse, error) {
+
+	s.audit(AuditEntry{Admin: userId, Action: "list_rooms"})
+	states := s.roomList.RoomStates()
+	response := &proto_lobby.AdminListRoomsResponse{
+		Rooms: make([]*proto_lobby.AdminRoomState, 0, len(states)),
+	}
+	for _, state := range states {
+		response.Rooms = append(response.Rooms, roomStateProto(state))
+	}
+	return response, nil
+}
+
+func roomStateProto(state lobby.RoomState) *proto_lobby.AdminRoomState {
+	result := &proto_lobby.AdminRoomState{
+		Room:      state.Room,
+		Status:    proto_lobby.AdminRoomState_NOT_STARTED.Enum(),
+		JoinOrder: userIdStrings(state.JoinOrder),
+	}
+	if state.Starting {
+		result.Status = proto_lobby.AdminRoomState_STARTING.Enum()
+		result.Ready = userIdStrings(state.Ready)
+		result.NotReady = userIdStrings(state.NotReady)
+		result.ReadyDeadline = pbuf.Int64(state.ReadyDeadline.UnixNano() / int64(time.Millisecond))
+	} else if state.InProgress {
+		result.Status = proto_lobby.AdminRoomState_IN_PROGRESS.Enum()
+	}
+	return result
+}
+
+func (s *lobbyServiceHandlers) adminCloseRoom(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.AdminCloseRoomRequest) (*proto_lobby.AdminCloseRoomResponse, error) {
+
+	err := s.roomList.CloseRoom(lobby.RoomId(request.GetRoomId()))
+	s.audit(AuditEntry{
+		Admin:  userId,
+		Action: "close_room",
+		RoomId: request.GetRoomId(),
+		Error:  errorString(err),
+	})
+	var errResponse *proto_lobby.AdminCloseRoomResponse_ErrorCode
+	if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.AdminCloseRoomResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err != nil {
+		logger.Error("Unknown close room error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.AdminCloseRoomResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) adminRemovePlayer(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.AdminRemovePlayerRequest) (*proto_lobby.AdminRemovePlayerResponse, error) {
+
+	player := user.Id(request.GetPlayer())
+	err := s.roomList.RemovePlayer(player, request.GetExpectedVersion())
+	s.audit(AuditEntry{
+		Admin:  userId,
+		Action: "remove_player",
+		Player: player,
+		Error:  errorString(err),
+	})
+	var errResponse *proto_lobby.AdminRemovePlayerResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.AdminRemovePlayerResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.AdminRemovePlayerResponse_VERSION_CONFLICT.Enum()
+	} else if err != nil {
+		logger.Error("Unknown remove player error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.AdminRemovePlayerResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) adminCancelStart(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.AdminCancelStartRequest) (*proto_lobby.AdminCancelStartResponse, error) {
+
+	err := s.roomList.CancelRoomStart(lobby.RoomId(request.GetRoomId()), request.GetExpectedVersion())
+	s.audit(AuditEntry{
+		Admin:  userId,
+		Action: "cancel_start",
+		RoomId: request.GetRoomId(),
+		Error:  errorString(err),
+	})
+	var errResponse *proto_lobby.AdminCancelStartResponse_ErrorCode
+	if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.AdminCancelStartResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrNotStarting {
+		errResponse = proto_lobby.AdminCancelStartResponse_NOT_STARTING.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.AdminCancelStartResponse_VERSION_CONFLICT.Enum()
+	} else if err != nil {
+		logger.Error("Unknown cancel start error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.AdminCancelStartResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) adminMovePlayer(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.AdminMovePlayerRequest) (*proto_lobby.AdminMovePlayerResponse, error) {
+
+	player := user.Id(request.GetPlayer())
+	room, err := s.roomList.MovePlayer(player, lobby.RoomId(request.GetRoomId()))
+	s.audit(AuditEntry{
+		Admin:  userId,
+		Action: "move_player",
+		RoomId: request.GetRoomId(),
+		Player: player,
+		Error:  errorString(err),
+	})
+	var errResponse *proto_lobby.AdminMovePlayerResponse_ErrorCode
+	if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.AdminMovePlayerResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrRoomFull {
+		errResponse = proto_lobby.AdminMovePlayerResponse_ROOM_FULL.Enum()
+	} else if err == lobby.ErrAlreadyInRoom {
+		errResponse = proto_lobby.AdminMovePlayerResponse_ALREADY_IN_ROOM.Enum()
+	} else if err != nil {
+		logger.Error("Unknown move player error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.AdminMovePlayerResponse{
+		Room:      room,
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func userIdStrings(userIds []user.Id) []string {
+	result := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		result = append(result, userId.String())
+	}
+	return result
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/opentarock/service-api/go/user"
+)
+
+// AuditEntry records an action performed by an admin.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Admin  user.Id   `json:"admin"`
+	Action string    `json:"action"`
+	RoomId string    `json:"room_id,omitempty"`
+	Player user.Id   `json:"player,omitempty"`
+	// Error is the reason the action failed, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditLog records the actions performed by admins.
+type AuditLog interface {
+	Record(entry AuditEntry)
+}
+
+// jsonAuditLog writes every entry as a line of JSON.
+type jsonAuditLog struct {
+	w    io.Writer
+	lock *sync.Mutex
+}
+
+// NewJsonAuditLog returns an AuditLog writing the entries to w, one JSON
+// object per line.
+func NewJsonAuditLog(w io.Writer) AuditLog {
+	return &jsonAuditLog{
+		w:    w,
+		lock: new(sync.Mutex),
+	}
+}
+
+func (l *jsonAuditLog) Record(entry AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry: %s", err)
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing audit entry: %s", err)
+	}
+}
+
+// SetAuditLog replaces the log of admin actions. It must be called before
+// the handlers start receiving requests.
+func (s *lobbyServiceHandlers) SetAuditLog(auditLog AuditLog) {
+	s.auditLog = auditLog
+}
+
+// audit records an admin action. The entry's time is set to the current
+// time.
+func (s *lobbyServiceHandlers) audit(entry AuditEntry) {
+	entry.Time = time.Now()
+	s.auditLog.Record(entry)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"strings"
+
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_errors"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+)
+
+// requestPermissions are the permissions required by requests other than
+// PermissionPlay, by request name.
+var requestPermissions = map[string]authz.Permission{
+	"reload_config":       authz.PermissionAdmin,
+	"admin_list_rooms":    authz.PermissionAdmin,
+	"admin_close_room":    authz.PermissionAdmin,
+	"admin_remove_player": authz.PermissionAdmin,
+	"admin_cancel_start":  authz.PermissionAdmin,
+	"admin_move_player":   authz.PermissionAdmin,
+}
+
+// SetPolicy replaces the policy deciding which requests users are allowed to
+// make. It must be called before the handlers start receiving requests.
+func (s *lobbyServiceHandlers) SetPolicy(policy authz.Policy) {
+	s.policy = policy
+}
+
+// Roles returns the store with the roles of the users.
+func (s *lobbyServiceHandlers) Roles() *authz.MemoryRoleStore {
+	return s.roles
+}
+
+// authorize returns authz.ErrPermissionDenied if the user is not allowed to
+// make the request. Denied admin requests are written to the audit log.
+func (s *lobbyServiceHandlers) authorize(userId user.Id, name string) error {
+	permission, ok := requestPermissions[name]
+	if !ok {
+		permission = authz.PermissionPlay
+	}
+	err := s.policy.Authorize(userId, s.roles.Role(userId), permission)
+	if err != nil && permission == authz.PermissionAdmin {
+		s.audit(AuditEntry{
+			Admin:  userId,
+			Action: strings.TrimPrefix(name, "admin_"),
+			Error:  errorString(err),
+		})
+	}
+	return err
+}
+
+// managesRooms reports whether the user may perform owner actions in rooms
+// they do not own.
+func (s *lobbyServiceHandlers) managesRooms(userId user.Id) bool {
+	return s.policy.Authorize(userId, s.roles.Role(userId), authz.PermissionManageRooms) == nil
+}
+
+// authorized wraps the run function of an operation with the authorization
+// check. Operations that do not require a user are only checked if they are
+// made by one, so banned users are refused them too.
+func (s *lobbyServiceHandlers) authorized(op operation) operation {
+	run := op.run
+	op.run = func(logger log15.Logger, userId user.Id, request proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+		if userId == "" && !op.requireAuth {
+			return run(logger, userId, request)
+		}
+		if err := s.authorize(userId, op.name); err != nil {
+			logger.Warn("Permission denied", "user_id", userId, "request", op.name)
+			return nil, err
+		}
+		return run(logger, userId, request)
+	}
+	return op
+}
+
+func permissionDeniedError(logger log15.Logger, userId user.Id) proto.CompositeMessage {
+	logger.Warn("Permission denied", "user_id", userId)
+	return proto.CompositeMessage{Message: proto_errors.NewPermissionDenied()}
+}
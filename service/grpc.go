@@ -0,0 +1,308 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	// grpc requires the standard library context in its handler signatures,
+	// x/net/context is the successor of go.net/context with the same type.
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// GrpcServiceName is the full name of the lobby gRPC service.
+const GrpcServiceName = "opentarock.lobby.Lobby"
+
+// grpcEventBufferSize is the number of events that can be queued for an
+// event stream before the stream is considered too slow and closed.
+const grpcEventBufferSize = 256
+
+// GrpcCodec encodes the gogoprotobuf generated lobby messages. Its wire
+// format is the same as the one of the standard protobuf codec so clients
+// can use the message definitions from service-api with any protobuf
+// implementation.
+var GrpcCodec = grpcCodec{}
+
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	return pbuf.Marshal(v.(pbuf.Message))
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	return pbuf.Unmarshal(data, v.(pbuf.Message))
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+// grpcSubscriber is an open event stream of a user.
+type grpcSubscriber struct {
+	userId user.Id
+	events chan *proto_lobby.Event
+	// overflow is closed if the subscriber did not keep up with events.
+	overflow  chan struct{}
+	closeOnce *sync.Once
+}
+
+// grpcServer serves the lobby API over gRPC.
+//
+// Every lobby request is an unary method named after the request, for
+// example CreateRoom takes a CreateRoomRequest and returns a
+// CreateRoomResponse with the same error codes as the nanomsg service.
+// WatchEvents streams all the events concerning the calling user. Like the
+// events of a WebSocket session they are numbered by a sequence of the user,
+// which starts again once all the user's streams are closed.
+// The user is identified by the pluggable Authenticator from the request
+// metadata, which is presented to it as HTTP headers.
+type grpcServer struct {
+	server      *grpc.Server
+	auth        Authenticator
+	roomList    *lobby.RoomList
+	logger      log15.Logger
+	subscribers map[*grpcSubscriber]bool
+	// seqs holds the sequence number of the latest event of every user with
+	// an open stream.
+	seqs     map[user.Id]uint64
+	stop     chan struct{}
+	stopOnce *sync.Once
+	lock     *sync.Mutex
+}
+
+// NewGrpcServer returns a new gRPC server sharing the room list with the
+// nanomsg handlers.
+func NewGrpcServer(handlers *lobbyServiceHandlers, auth Authenticator) *grpcServer {
+	s := &grpcServer{
+		server:      grpc.NewServer(grpc.ForceServerCodec(GrpcCodec)),
+		auth:        auth,
+		roomList:    handlers.roomList,
+		logger:      log15.New("service_name", serviceName, "transport", "grpc"),
+		subscribers: make(map[*grpcSubscriber]bool),
+		seqs:        make(map[user.Id]uint64),
+		stop:        make(chan struct{}),
+		stopOnce:    new(sync.Once),
+		lock:        new(sync.Mutex),
+	}
+	desc := grpc.ServiceDesc{
+		ServiceName: GrpcServiceName,
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "WatchEvents",
+				Handler:       s.watchEvents,
+				ServerStreams: true,
+			},
+		},
+	}
+	for _, op := range handlers.operations() {
+		desc.Methods = append(desc.Methods, s.method(op))
+	}
+	s.server.RegisterService(&desc, s)
+	handlers.roomList.AddEventListener(s.publish)
+	return s
+}
+
+// Serve accepts connections on lis until Stop is called.
+func (s *grpcServer) Serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// Stop stops accepting connections and waits for pending requests to finish.
+// Event streams are closed.
+func (s *grpcServer) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.server.GracefulStop()
+}
+
+// method returns the gRPC method running op.
+func (s *grpcServer) method(op operation) grpc.MethodDesc {
+	name := grpcMethodName(op.name)
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := op.newRequest()
+			if err := dec(request); err != nil {
+				s.logger.Error("Malformed request", "error", err, "msg_type", request.GetMessageType())
+				return nil, status.Errorf(codes.InvalidArgument, "Malformed request")
+			}
+			run := func(ctx context.Context, request interface{}) (interface{}, error) {
+				return s.run(ctx, op, request.(proto.ProtobufMessage))
+			}
+			if interceptor == nil {
+				return run(ctx, request)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + GrpcServiceName + "/" + name,
+			}
+			return interceptor(ctx, request, info, run)
+		},
+	}
+}
+
+func (s *grpcServer) run(ctx context.Context, op operation, request proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+	logger := s.logger.New("method", grpcMethodName(op.name))
+	userId, err := s.authenticate(ctx)
+	if err != nil && op.requireAuth {
+		logger.Error("Request not authenticated", "error", err)
+		return nil, status.Errorf(codes.Unauthenticated, "Not authenticated")
+	}
+	response, err := op.run(logger, userId, request)
+	if err == ErrRateLimited {
+		return nil, status.Errorf(codes.ResourceExhausted, "Rate limit exceeded")
+	} else if err == authz.ErrPermissionDenied {
+		return nil, status.Errorf(codes.PermissionDenied, "Permission denied")
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "Internal error")
+	}
+	return response, nil
+}
+
+// authenticate identifies the user with the request metadata.
+func (s *grpcServer) authenticate(ctx context.Context) (user.Id, error) {
+	header := make(http.Header)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		}
+	}
+	return s.auth.Authenticate(&http.Request{
+		Header: header,
+		URL:    &url.URL{},
+	})
+}
+
+func (s *grpcServer) watchEvents(srv interface{}, stream grpc.ServerStream) error {
+	var request proto_lobby.WatchEventsRequest
+	if err := stream.RecvMsg(&request); err != nil {
+		return err
+	}
+	userId, err := s.authenticate(stream.Context())
+	if err != nil {
+		s.logger.Error("Request not authenticated", "error", err)
+		return status.Errorf(codes.Unauthenticated, "Not authenticated")
+	}
+	sub := &grpcSubscriber{
+		userId:    userId,
+		events:    make(chan *proto_lobby.Event, grpcEventBufferSize),
+		overflow:  make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+	s.subscribe(sub)
+	defer s.unsubscribe(sub)
+	// An open event stream counts as a session for the player's presence.
+	s.roomList.Connected(userId)
+	defer s.roomList.Disconnected(userId)
+	// Headers tell the client that it will receive all the events from now on.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case event := <-sub.events:
+			if err := stream.SendMsg(event); err != nil {
+				return err
+			}
+		case <-sub.overflow:
+			return status.Errorf(codes.ResourceExhausted, "Too many pending events")
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stop:
+			return status.Errorf(codes.Unavailable, "Server is stopping")
+		}
+	}
+}
+
+func (s *grpcServer) subscribe(sub *grpcSubscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.subscribers[sub] = true
+}
+
+func (s *grpcServer) unsubscribe(sub *grpcSubscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.subscribers, sub)
+	for other := range s.subscribers {
+		if other.userId == sub.userId {
+			return
+		}
+	}
+	delete(s.seqs, sub.userId)
+}
+
+// publish is the lobby event listener that sends events to the streams of
+// the users concerned.
+func (s *grpcServer) publish(msg proto.ProtobufMessage, users []user.Id) {
+	data, err := pbuf.Marshal(msg)
+	if err != nil {
+		s.logger.Error("Error encoding event", "error", err, "msg_type", msg.GetMessageType())
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// All the streams of a user receive the event with the same sequence
+	// number.
+	events := make(map[user.Id]*proto_lobby.Event)
+	for sub := range s.subscribers {
+		if len(users) == 0 || containsUser(users, sub.userId) {
+			event, ok := events[sub.userId]
+			if !ok {
+				s.seqs[sub.userId]++
+				event = &proto_lobby.Event{
+					Sequence: pbuf.Uint64(s.seqs[sub.userId]),
+					Type:     pbuf.Uint32(uint32(msg.GetMessageType())),
+					Data:     data,
+				}
+				events[sub.userId] = event
+			}
+			select {
+			case sub.events <- event:
+			default:
+				sub.closeOnce.Do(func() {
+					close(sub.overflow)
+				})
+			}
+		}
+	}
+}
+
+func containsUser(users []user.Id, userId user.Id) bool {
+	for _, u := range users {
+		if u == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcMethodName converts an operation name to the gRPC method name, for
+// example create_room becomes CreateRoom.
+func grpcMethodName(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
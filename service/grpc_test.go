@@ -0,0 +1,164 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/service"
+)
+
+func makeGrpcClient(t *testing.T) (*grpc.ClientConn, func()) {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	server := service.NewGrpcServer(handlers, service.HeaderAuthenticator{Header: "X-User-Id"})
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(service.GrpcCodec)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func userContext(userId user.Id) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	return metadata.AppendToOutgoingContext(ctx, "x-user-id", userId.String()), cancel
+}
+
+func method(name string) string {
+	return "/" + service.GrpcServiceName + "/" + name
+}
+
+func TestGrpcCreateRoom(t *testing.T) {
+	conn, closeConn := makeGrpcClient(t)
+	defer closeConn()
+	ctx, cancel := userContext("1")
+	defer cancel()
+
+	var response proto_lobby.CreateRoomResponse
+	err := conn.Invoke(ctx, method("CreateRoom"), &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")}, &response)
+	assert.Nil(t, err)
+	assert.Equal(t, "room", response.GetRoom().GetName())
+	assert.Equal(t, "1", response.GetRoom().GetOwner())
+}
+
+func TestGrpcErrorCodesMatchServiceErrorCodes(t *testing.T) {
+	conn, closeConn := makeGrpcClient(t)
+	defer closeConn()
+	ctx, cancel := userContext("1")
+	defer cancel()
+
+	var response proto_lobby.StartGameResponse
+	err := conn.Invoke(ctx, method("StartGame"), &proto_lobby.StartGameRequest{}, &response)
+	assert.Nil(t, err)
+	assert.Equal(t, proto_lobby.StartGameResponse_NOT_IN_ROOM, response.GetErrorCode())
+}
+
+func TestGrpcRequestWithoutUserIsRejected(t *testing.T) {
+	conn, closeConn := makeGrpcClient(t)
+	defer closeConn()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var response proto_lobby.CreateRoomResponse
+	err := conn.Invoke(ctx, method("CreateRoom"), &proto_lobby.CreateRoomRequest{}, &response)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// watchEvents opens an event stream and waits until it is registered.
+func watchEvents(t *testing.T, conn *grpc.ClientConn, ctx context.Context) grpc.ClientStream {
+	desc := &grpc.StreamDesc{StreamName: "WatchEvents", ServerStreams: true}
+	stream, err := conn.NewStream(ctx, desc, method("WatchEvents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, stream.SendMsg(&proto_lobby.WatchEventsRequest{}))
+	assert.Nil(t, stream.CloseSend())
+	// Headers are sent after the stream is registered.
+	_, err = stream.Header()
+	assert.Nil(t, err)
+	return stream
+}
+
+func TestGrpcWatchEvents(t *testing.T) {
+	conn, closeConn := makeGrpcClient(t)
+	defer closeConn()
+	ownerCtx, cancel := userContext("1")
+	defer cancel()
+	playerCtx, cancel := userContext("2")
+	defer cancel()
+
+	stream := watchEvents(t, conn, ownerCtx)
+
+	var created proto_lobby.CreateRoomResponse
+	conn.Invoke(ownerCtx, method("CreateRoom"), &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")}, &created)
+	var joined proto_lobby.JoinRoomResponse
+	conn.Invoke(playerCtx, method("JoinRoom"), &proto_lobby.JoinRoomRequest{RoomId: created.GetRoom().Id}, &joined)
+
+	var event proto_lobby.Event
+	assert.Nil(t, stream.RecvMsg(&event))
+	assert.Equal(t, proto_lobby.RoomCreatedEventMessage, event.GetType())
+	assert.Nil(t, stream.RecvMsg(&event))
+	assert.Equal(t, proto_lobby.JoinRoomEventMessage, event.GetType())
+	var joinEvent proto_lobby.JoinRoomEvent
+	assert.Nil(t, pbuf.Unmarshal(event.Data, &joinEvent))
+	assert.Equal(t, "2", joinEvent.GetPlayer())
+}
+
+func TestGrpcEventSequenceIsPerUser(t *testing.T) {
+	conn, closeConn := makeGrpcClient(t)
+	defer closeConn()
+	watcherCtx, cancel := userContext("1")
+	defer cancel()
+	ownerCtx, cancel := userContext("2")
+	defer cancel()
+	playerCtx, cancel := userContext("3")
+	defer cancel()
+	stream := watchEvents(t, conn, watcherCtx)
+
+	var created proto_lobby.CreateRoomResponse
+	conn.Invoke(ownerCtx, method("CreateRoom"), &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")}, &created)
+	// The watcher isn't in the room so this event is not counted.
+	var joined proto_lobby.JoinRoomResponse
+	conn.Invoke(playerCtx, method("JoinRoom"), &proto_lobby.JoinRoomRequest{RoomId: created.GetRoom().Id}, &joined)
+	conn.Invoke(watcherCtx, method("CreateRoom"), &proto_lobby.CreateRoomRequest{Name: pbuf.String("other")}, &created)
+
+	var event proto_lobby.Event
+	assert.Nil(t, stream.RecvMsg(&event))
+	assert.Equal(t, uint64(1), event.GetSequence())
+	assert.Nil(t, stream.RecvMsg(&event))
+	assert.Equal(t, proto_lobby.RoomCreatedEventMessage, event.GetType())
+	assert.Equal(t, uint64(2), event.GetSequence())
+}
+
+func TestGrpcServerCanBeStoppedTwice(t *testing.T) {
+	_, closeConn := makeGrpcClient(t)
+	closeConn()
+	assert.NotPanics(t, closeConn)
+}
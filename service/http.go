@@ -0,0 +1,143 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+)
+
+// maxRequestBodySize limits the size of a JSON request body.
+const maxRequestBodySize = 64 * 1024
+
+// Authenticator extracts the id of the user making a HTTP request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (user.Id, error)
+}
+
+// ErrUnauthenticated is returned by an Authenticator if the request does not
+// identify a user.
+var ErrUnauthenticated = errors.New("Request is not authenticated")
+
+// HeaderAuthenticator takes the user id from a request header.
+// It should only be used behind a proxy that sets the header itself.
+type HeaderAuthenticator struct {
+	Header string
+}
+
+func (a HeaderAuthenticator) Authenticate(r *http.Request) (user.Id, error) {
+	userId := r.Header.Get(a.Header)
+	if userId == "" {
+		return "", ErrUnauthenticated
+	}
+	return user.Id(userId), nil
+}
+
+// BearerAuthenticator takes the user id from a bearer token in the
+// Authorization header or in the access_token query parameter for clients
+// that can't set headers, like browsers opening a WebSocket.
+// Lookup returns the user the token belongs to and false if the token is not
+// valid.
+type BearerAuthenticator struct {
+	Lookup func(token string) (user.Id, bool)
+}
+
+func (a BearerAuthenticator) Authenticate(r *http.Request) (user.Id, error) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	token := r.URL.Query().Get("access_token")
+	if strings.HasPrefix(header, prefix) {
+		token = strings.TrimPrefix(header, prefix)
+	}
+	if token == "" {
+		return "", ErrUnauthenticated
+	}
+	userId, ok := a.Lookup(token)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return userId, nil
+}
+
+// httpGateway exposes the lobby requests as JSON over HTTP.
+// Every endpoint accepts a POST request with the JSON encoded request message
+// and responds with the JSON encoded response message.
+type httpGateway struct {
+	handlers *lobbyServiceHandlers
+	auth     Authenticator
+	logger   log15.Logger
+	mux      *http.ServeMux
+}
+
+// NewHttpHandler returns a http.Handler serving the lobby API as JSON.
+// Users are identified by auth.
+func NewHttpHandler(handlers *lobbyServiceHandlers, auth Authenticator) http.Handler {
+	g := &httpGateway{
+		handlers: handlers,
+		auth:     auth,
+		logger:   log15.New("service_name", serviceName, "transport", "http"),
+		mux:      http.NewServeMux(),
+	}
+	for _, op := range handlers.operations() {
+		g.handle("/lobby/"+op.name, op)
+	}
+	return g.mux
+}
+
+// handle registers an endpoint for op at path. A new request message is
+// decoded from the body and passed to op together with the authenticated user.
+func (g *httpGateway) handle(path string, op operation) {
+	g.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		logger := g.logger.New("path", path)
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			writeJsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		request := op.newRequest()
+		if r.ContentLength != 0 {
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+			if err := decoder.Decode(request); err != nil {
+				logger.Error("Malformed request", "error", err, "msg_type", request.GetMessageType())
+				writeJsonError(w, http.StatusBadRequest, "Malformed request")
+				return
+			}
+		}
+
+		userId, err := g.auth.Authenticate(r)
+		if err != nil && op.requireAuth {
+			logger.Error("Request not authenticated", "error", err)
+			writeJsonError(w, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+
+		response, err := op.run(logger, userId, request)
+		if err == ErrRateLimited {
+			writeJsonError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		} else if err == authz.ErrPermissionDenied {
+			writeJsonError(w, http.StatusForbidden, "Permission denied")
+			return
+		} else if err != nil {
+			writeJsonError(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+		writeJson(w, http.StatusOK, response)
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJsonError(w http.ResponseWriter, status int, message string) {
+	writeJson(w, status, map[string]string{"error": message})
+}
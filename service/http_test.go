@@ -0,0 +1,482 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/service"
+)
+
+func makeGateway(t *testing.T) *httptest.Server {
+	return makeGatewayWithRoles(t, nil)
+}
+
+func makeGatewayWithRoles(t *testing.T, roles map[user.Id]authz.Role) *httptest.Server {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	for userId, role := range roles {
+		handlers.Roles().SetRole(userId, role)
+	}
+	auth := service.HeaderAuthenticator{Header: "X-User-Id"}
+	return httptest.NewServer(service.NewHttpHandler(handlers, auth))
+}
+
+func post(t *testing.T, server *httptest.Server, path string, userId user.Id, body string, response interface{}) int {
+	req, err := http.NewRequest("POST", server.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId != "" {
+		req.Header.Set("X-User-Id", userId.String())
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if response != nil {
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHttpCreateAndJoinRoom(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	status := post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, created.ErrorCode)
+	assert.Equal(t, "room", created.GetRoom().GetName())
+	assert.Equal(t, "1", created.GetRoom().GetOwner())
+
+	var joined proto_lobby.JoinRoomResponse
+	body, _ := json.Marshal(&proto_lobby.JoinRoomRequest{RoomId: created.GetRoom().Id})
+	status = post(t, server, "/lobby/join_room", "2", string(body), &joined)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, joined.ErrorCode)
+	assert.Contains(t, joined.GetRoom().GetPlayers(), "2")
+
+	var info proto_lobby.RoomInfoResponse
+	body, _ = json.Marshal(&proto_lobby.RoomInfoRequest{RoomId: created.GetRoom().Id})
+	status = post(t, server, "/lobby/room_info", "", string(body), &info)
+	assert.Equal(t, http.StatusOK, status, "Room info does not require authentication")
+	assert.Equal(t, created.GetRoom().GetId(), info.GetRoom().GetId())
+}
+
+func TestHttpErrorCodesMatchServiceErrorCodes(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var left proto_lobby.LeaveRoomResponse
+	post(t, server, "/lobby/leave_room", "1", "", &left)
+	assert.Equal(t, proto_lobby.LeaveRoomResponse_NOT_IN_ROOM, left.GetErrorCode())
+
+	var started proto_lobby.StartGameResponse
+	post(t, server, "/lobby/start_game", "1", "", &started)
+	assert.Equal(t, proto_lobby.StartGameResponse_NOT_IN_ROOM, started.GetErrorCode())
+
+	var ready proto_lobby.PlayerReadyResponse
+	post(t, server, "/lobby/player_ready", "1", `{"State": "state"}`, &ready)
+	assert.Equal(t, proto_lobby.PlayerReadyResponse_NOT_IN_ROOM, ready.GetErrorCode())
+
+	var sent proto_lobby.SendRoomMessageResponse
+	post(t, server, "/lobby/send_room_message", "1", `{"Text": "hello"}`, &sent)
+	assert.Equal(t, proto_lobby.SendRoomMessageResponse_NOT_IN_ROOM, sent.GetErrorCode())
+
+	var voted proto_lobby.CastVoteResponse
+	post(t, server, "/lobby/cast_vote", "1", `{"VoteId": "vote", "Yes": true}`, &voted)
+	assert.Equal(t, proto_lobby.CastVoteResponse_NOT_IN_ROOM, voted.GetErrorCode())
+}
+
+func TestHttpGetMyRoom(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	post(t, server, "/lobby/start_game", "1", "", nil)
+
+	var mine proto_lobby.GetMyRoomResponse
+	status := post(t, server, "/lobby/get_my_room", "1", "", &mine)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, created.GetRoom().GetId(), mine.GetRoom().GetId())
+	assert.Equal(t, proto_lobby.GetMyRoomResponse_IN_PROGRESS, mine.GetStatus())
+	assert.Nil(t, mine.Game, "There is no game server to connect to")
+
+	var notInRoom proto_lobby.GetMyRoomResponse
+	post(t, server, "/lobby/get_my_room", "2", "", &notInRoom)
+	assert.Equal(t, proto_lobby.GetMyRoomResponse_NOT_IN_ROOM, notInRoom.GetErrorCode())
+}
+
+func TestHttpListRoomsExcludesOwnRoom(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room1"}`, nil)
+	post(t, server, "/lobby/create_room", "2", `{"Name": "room2"}`, nil)
+
+	var list proto_lobby.ListRoomsResponse
+	post(t, server, "/lobby/list_rooms", "1", "", &list)
+	assert.Equal(t, 1, len(list.GetRooms()))
+	assert.Equal(t, "room2", list.GetRooms()[0].GetName())
+}
+
+func TestHttpConditionalListAndRoomInfo(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	roomId := created.GetRoom().GetId()
+
+	var list proto_lobby.ListRoomsResponse
+	post(t, server, "/lobby/list_rooms", "2", "", &list)
+	var unchanged proto_lobby.ListRoomsResponse
+	post(t, server, "/lobby/list_rooms", "2", fmt.Sprintf(`{"IfChangedSince": %d}`, list.GetVersion()), &unchanged)
+	assert.True(t, unchanged.GetNotModified())
+	assert.Empty(t, unchanged.GetRooms())
+
+	var info proto_lobby.RoomInfoResponse
+	post(t, server, "/lobby/room_info", "2", fmt.Sprintf(`{"RoomId": %q, "IfChangedSince": %d}`, roomId, created.GetRoom().GetVersion()), &info)
+	assert.True(t, info.GetNotModified())
+	assert.Nil(t, info.GetRoom())
+
+	post(t, server, "/lobby/join_room", "2", fmt.Sprintf(`{"RoomId": %q}`, roomId), nil)
+	var changed proto_lobby.ListRoomsResponse
+	post(t, server, "/lobby/list_rooms", "3", fmt.Sprintf(`{"IfChangedSince": %d}`, list.GetVersion()), &changed)
+	assert.False(t, changed.GetNotModified())
+	assert.True(t, changed.GetVersion() > list.GetVersion())
+	if assert.Len(t, changed.GetRooms(), 1) {
+		assert.Equal(t, []string{"2"}, changed.GetRooms()[0].GetPlayers())
+	}
+}
+
+func TestHttpUpdateRoom(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	body := fmt.Sprintf(`{"Name": "renamed", "ExpectedVersion": %d}`, created.GetRoom().GetVersion())
+	var updated proto_lobby.UpdateRoomResponse
+	status := post(t, server, "/lobby/update_room", "1", body, &updated)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, updated.ErrorCode)
+	assert.Equal(t, "renamed", updated.GetRoom().GetName())
+
+	var stale proto_lobby.UpdateRoomResponse
+	post(t, server, "/lobby/update_room", "1", body, &stale)
+	assert.Equal(t, proto_lobby.UpdateRoomResponse_VERSION_CONFLICT, stale.GetErrorCode())
+}
+
+func TestHttpVoteToTransferOwnership(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	body, _ := json.Marshal(&proto_lobby.JoinRoomRequest{RoomId: created.GetRoom().Id})
+	post(t, server, "/lobby/join_room", "2", string(body), nil)
+
+	var started proto_lobby.StartVoteResponse
+	body, _ = json.Marshal(&proto_lobby.StartVoteRequest{
+		Kind:   proto_lobby.Vote_TRANSFER_OWNERSHIP.Enum(),
+		Target: pbuf.String("2"),
+	})
+	post(t, server, "/lobby/start_vote", "2", string(body), &started)
+	assert.Nil(t, started.ErrorCode)
+
+	var mine proto_lobby.GetMyRoomResponse
+	post(t, server, "/lobby/get_my_room", "1", "", &mine)
+	assert.Equal(t, started.GetVote().GetId(), mine.GetVote().GetId())
+
+	var voted proto_lobby.CastVoteResponse
+	body, _ = json.Marshal(&proto_lobby.CastVoteRequest{VoteId: started.GetVote().Id, Yes: pbuf.Bool(true)})
+	post(t, server, "/lobby/cast_vote", "1", string(body), &voted)
+	assert.Nil(t, voted.ErrorCode)
+
+	var info proto_lobby.RoomInfoResponse
+	body, _ = json.Marshal(&proto_lobby.RoomInfoRequest{RoomId: created.GetRoom().Id})
+	post(t, server, "/lobby/room_info", "", string(body), &info)
+	assert.Equal(t, "2", info.GetRoom().GetOwner())
+}
+
+func TestHttpRetriedRequestGetsOriginalResponse(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created, retried proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room", "IdempotencyKey": "a"}`, &created)
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room", "IdempotencyKey": "a"}`, &retried)
+	assert.Nil(t, retried.ErrorCode)
+	assert.Equal(t, created.GetRoom().GetId(), retried.GetRoom().GetId())
+
+	var another proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room", "IdempotencyKey": "b"}`, &another)
+	assert.Equal(t, proto_lobby.CreateRoomResponse_ALREADY_IN_ROOM, another.GetErrorCode())
+
+	body := fmt.Sprintf(`{"RoomId": %q, "IdempotencyKey": "a"}`, created.GetRoom().GetId())
+	post(t, server, "/lobby/join_room", "2", body, nil)
+	post(t, server, "/lobby/leave_room", "2", "", nil)
+	var joined proto_lobby.JoinRoomResponse
+	post(t, server, "/lobby/join_room", "2", body, &joined)
+	assert.Contains(t, joined.GetRoom().GetPlayers(), "2")
+	var mine proto_lobby.GetMyRoomResponse
+	post(t, server, "/lobby/get_my_room", "2", "", &mine)
+	assert.Equal(t, proto_lobby.GetMyRoomResponse_NOT_IN_ROOM, mine.GetErrorCode(), "Retried join is not applied again")
+}
+
+func TestHttpIdempotencyKeyCantBeReused(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	var created, reused proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room", "IdempotencyKey": "a"}`, &created)
+	post(t, server, "/lobby/create_room", "1", `{"Name": "other", "IdempotencyKey": "a"}`, &reused)
+	assert.Nil(t, created.ErrorCode)
+	assert.Equal(t, proto_lobby.CreateRoomResponse_IDEMPOTENCY_KEY_REUSED, reused.GetErrorCode())
+
+	var joined proto_lobby.JoinRoomResponse
+	post(t, server, "/lobby/join_room", "2", `{"RoomId": "missing", "IdempotencyKey": "a"}`, nil)
+	body := fmt.Sprintf(`{"RoomId": %q, "IdempotencyKey": "a"}`, created.GetRoom().GetId())
+	post(t, server, "/lobby/join_room", "2", body, &joined)
+	assert.Equal(t, proto_lobby.JoinRoomResponse_IDEMPOTENCY_KEY_REUSED, joined.GetErrorCode())
+}
+
+func TestHttpRequestWithoutUserIsRejected(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	status := post(t, server, "/lobby/create_room", "", `{"Name": "room"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestHttpMalformedRequestIsRejected(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	status := post(t, server, "/lobby/create_room", "1", `{"Name": `, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestHttpOnlyPostIsAllowed(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/lobby/list_rooms")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestBearerAuthenticator(t *testing.T) {
+	auth := service.BearerAuthenticator{
+		Lookup: func(token string) (user.Id, bool) {
+			return user.Id("7"), token == "secret"
+		},
+	}
+	req, _ := http.NewRequest("POST", "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	userId, err := auth.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, user.Id("7"), userId)
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	_, err = auth.Authenticate(req)
+	assert.Equal(t, service.ErrUnauthenticated, err)
+}
+
+func TestLoadAccessTokens(t *testing.T) {
+	f, err := ioutil.TempFile("", "lobby-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# token user\nsecret 7\n\nother 8\n")
+	f.Close()
+
+	tokens, err := service.LoadAccessTokens(f.Name())
+	if !assert.Nil(t, err) {
+		return
+	}
+	auth := service.BearerAuthenticator{Lookup: tokens.Lookup}
+	req, _ := http.NewRequest("POST", "/?access_token=other", nil)
+	userId, err := auth.Authenticate(req)
+	assert.Nil(t, err)
+	assert.Equal(t, user.Id("8"), userId)
+	_, ok := tokens.Lookup("7")
+	assert.False(t, ok)
+
+	ioutil.WriteFile(f.Name(), []byte("secret\n"), 0644)
+	_, err = service.LoadAccessTokens(f.Name())
+	assert.NotNil(t, err, "A token needs a user")
+}
+
+func TestHttpRequestsAreRateLimitedPerUser(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	limit := config.Default().RateLimits["list_rooms"]
+	for i := uint(0); i < limit.Burst; i++ {
+		assert.Equal(t, http.StatusOK, post(t, server, "/lobby/list_rooms", "1", "", nil))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, post(t, server, "/lobby/list_rooms", "1", "", nil))
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/list_rooms", "2", "", nil), "Other users are not limited")
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/room_info", "1", "", nil), "Requests are limited separately")
+}
+
+func TestHttpAnonymousRequestsDontShareBucket(t *testing.T) {
+	server := makeGateway(t)
+	defer server.Close()
+
+	limit := config.Default().DefaultRateLimit
+	for i := uint(0); i <= limit.Burst; i++ {
+		assert.Equal(t, http.StatusOK, post(t, server, "/lobby/room_info", "", "", nil))
+	}
+}
+
+func TestHttpReloadKeepsUnchangedRateLimits(t *testing.T) {
+	f, err := ioutil.TempFile("", "lobby-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"rate_limits": {"list_rooms": {"rate": 1, "burst": 2}}}`)
+	f.Close()
+	conf, err := config.NewManager(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	server := httptest.NewServer(service.NewHttpHandler(handlers, service.HeaderAuthenticator{Header: "X-User-Id"}))
+	defer server.Close()
+
+	post(t, server, "/lobby/list_rooms", "1", "", nil)
+	post(t, server, "/lobby/list_rooms", "1", "", nil)
+	assert.Equal(t, http.StatusTooManyRequests, post(t, server, "/lobby/list_rooms", "1", "", nil))
+
+	ioutil.WriteFile(f.Name(), []byte(`{"rate_limits": {"list_rooms": {"rate": 1, "burst": 2}, "create_room": {"rate": 1, "burst": 1}}}`), 0644)
+	conf.Reload()
+	assert.Equal(t, http.StatusTooManyRequests, post(t, server, "/lobby/list_rooms", "1", "", nil))
+
+	ioutil.WriteFile(f.Name(), []byte(`{"rate_limits": {"list_rooms": {"rate": 1, "burst": 3}}}`), 0644)
+	conf.Reload()
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/list_rooms", "1", "", nil), "Changed limits start with a full bucket")
+}
+
+func TestHttpBannedUserIsRefused(t *testing.T) {
+	server := makeGatewayWithRoles(t, map[user.Id]authz.Role{"1": authz.RoleBanned})
+	defer server.Close()
+
+	assert.Equal(t, http.StatusForbidden, post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, nil))
+	assert.Equal(t, http.StatusForbidden, post(t, server, "/lobby/list_rooms", "1", "", nil))
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/list_rooms", "2", "", nil))
+	assert.Equal(t, http.StatusForbidden, post(t, server, "/lobby/room_info", "1", `{"RoomId": "room"}`, nil))
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/room_info", "", `{"RoomId": "room"}`, nil))
+}
+
+func TestHttpModeratorManagesRoomsOfOtherUsers(t *testing.T) {
+	server := makeGatewayWithRoles(t, map[user.Id]authz.Role{"3": authz.RoleModerator})
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	body, _ := json.Marshal(&proto_lobby.JoinRoomRequest{RoomId: created.GetRoom().Id})
+	post(t, server, "/lobby/join_room", "2", string(body), nil)
+	post(t, server, "/lobby/join_room", "3", string(body), nil)
+
+	var started proto_lobby.StartGameResponse
+	post(t, server, "/lobby/start_game", "2", "", &started)
+	assert.Equal(t, proto_lobby.StartGameResponse_NOT_OWNER, started.GetErrorCode())
+
+	started = proto_lobby.StartGameResponse{}
+	post(t, server, "/lobby/start_game", "3", "", &started)
+	assert.Nil(t, started.ErrorCode)
+}
+
+func TestHttpModeratorManagesNamedRoom(t *testing.T) {
+	server := makeGatewayWithRoles(t, map[user.Id]authz.Role{"3": authz.RoleModerator})
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+	post(t, server, "/lobby/create_room", "2", `{"Name": "other"}`, nil)
+	body, _ := json.Marshal(&proto_lobby.StartGameRequest{RoomId: created.GetRoom().Id})
+
+	var started proto_lobby.StartGameResponse
+	post(t, server, "/lobby/start_game", "2", string(body), &started)
+	assert.Equal(t, proto_lobby.StartGameResponse_NOT_OWNER, started.GetErrorCode())
+
+	started = proto_lobby.StartGameResponse{}
+	post(t, server, "/lobby/start_game", "3", `{"RoomId": "unknown"}`, &started)
+	assert.Equal(t, proto_lobby.StartGameResponse_ROOM_DOES_NOT_EXIST, started.GetErrorCode())
+
+	started = proto_lobby.StartGameResponse{}
+	post(t, server, "/lobby/start_game", "3", string(body), &started)
+	assert.Nil(t, started.ErrorCode, "Moderators don't need to be in the room")
+}
+
+func TestHttpAdminRequestsAreAudited(t *testing.T) {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	handlers.Roles().SetRole("admin", authz.RoleAdmin)
+	var audit bytes.Buffer
+	handlers.SetAuditLog(service.NewJsonAuditLog(&audit))
+	server := httptest.NewServer(service.NewHttpHandler(handlers, service.HeaderAuthenticator{Header: "X-User-Id"}))
+	defer server.Close()
+
+	var created proto_lobby.CreateRoomResponse
+	post(t, server, "/lobby/create_room", "1", `{"Name": "room"}`, &created)
+
+	assert.Equal(t, http.StatusForbidden, post(t, server, "/lobby/admin_list_rooms", "1", "", nil))
+
+	var list proto_lobby.AdminListRoomsResponse
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/admin_list_rooms", "admin", "", &list))
+	assert.Equal(t, 1, len(list.GetRooms()))
+	assert.Equal(t, []string{"1"}, list.GetRooms()[0].GetJoinOrder())
+
+	var closed proto_lobby.AdminCloseRoomResponse
+	body, _ := json.Marshal(&proto_lobby.AdminCloseRoomRequest{RoomId: created.GetRoom().Id})
+	assert.Equal(t, http.StatusOK, post(t, server, "/lobby/admin_close_room", "admin", string(body), &closed))
+	assert.Nil(t, closed.ErrorCode)
+
+	decoder := json.NewDecoder(&audit)
+	var entries []service.AuditEntry
+	for decoder.More() {
+		var entry service.AuditEntry
+		assert.Nil(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	if !assert.Equal(t, 3, len(entries)) {
+		return
+	}
+	assert.Equal(t, "list_rooms", entries[0].Action)
+	assert.Equal(t, user.Id("1"), entries[0].Admin)
+	assert.Equal(t, authz.ErrPermissionDenied.Error(), entries[0].Error, "Denied attempts are audited")
+	assert.Equal(t, "close_room", entries[2].Action)
+	assert.Equal(t, user.Id("admin"), entries[2].Admin)
+	assert.Equal(t, created.GetRoom().GetId(), entries[2].RoomId)
+}
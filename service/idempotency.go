@@ -0,0 +1,188 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// ErrIdempotencyKeyReused is returned if a request carries the idempotency key
+// of an earlier request that was different.
+var ErrIdempotencyKeyReused = errors.New("Idempotency key reused for a different request")
+
+// errRequestAborted is the error retries get if the request they are waiting
+// for panicked.
+var errRequestAborted = errors.New("Request aborted")
+
+// responseCache remembers the responses to requests that carried an
+// idempotency key so a retried request gets the original response instead of
+// running again. Every user keeps at most maxPerUser responses, the oldest
+// one is forgotten first, and responses expire after ttl.
+type responseCache struct {
+	ttl        time.Duration
+	maxPerUser uint
+	users      map[user.Id][]*cachedResponse
+	clock      util.Clock
+	lastSweep  time.Time
+	lock       *sync.Mutex
+}
+
+// cachedResponse is the response to the request with the key. The done
+// channel is closed once the request has been handled, a retry arriving
+// before that waits for the response. The fingerprint identifies the request
+// so a key can't be reused for a different one.
+type cachedResponse struct {
+	name        string
+	key         string
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+	done        chan struct{}
+	response    proto.ProtobufMessage
+	err         error
+}
+
+func newResponseCache(clock util.Clock) *responseCache {
+	return &responseCache{
+		users:     make(map[user.Id][]*cachedResponse),
+		clock:     clock,
+		lastSweep: clock.Now(),
+		lock:      new(sync.Mutex),
+	}
+}
+
+// setLimits changes how long and how many responses are kept. A zero ttl or
+// maxPerUser disables the cache. Responses already in the cache are kept
+// until the next sweep.
+func (c *responseCache) setLimits(ttl time.Duration, maxPerUser uint) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ttl = ttl
+	c.maxPerUser = maxPerUser
+}
+
+// do returns the cached response to the user's request with the name and key
+// or runs the request and caches its response. Requests without a key always
+// run. A request with the key of a different request returns
+// ErrIdempotencyKeyReused. Unexpected errors and panics are not cached so the
+// request can be retried.
+func (c *responseCache) do(
+	userId user.Id,
+	name, key string,
+	request proto.ProtobufMessage,
+	run func() (proto.ProtobufMessage, error)) (proto.ProtobufMessage, error) {
+
+	if key == "" {
+		return run()
+	}
+	data, err := pbuf.Marshal(request.(pbuf.Message))
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := sha256.Sum256(data)
+	entry, found := c.lookup(userId, name, key, fingerprint)
+	if entry == nil {
+		return run()
+	}
+	if found {
+		if entry.fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		<-entry.done
+		return entry.response, entry.err
+	}
+	// Retries waiting for the response are released even if run panics, the
+	// entry is dropped then so the request can run again.
+	defer close(entry.done)
+	completed := false
+	defer func() {
+		if !completed {
+			entry.err = errRequestAborted
+			c.remove(userId, entry)
+		}
+	}()
+	entry.response, entry.err = run()
+	completed = true
+	if entry.err != nil {
+		c.remove(userId, entry)
+	}
+	return entry.response, entry.err
+}
+
+// lookup returns the unexpired entry for the request and true, or a new entry
+// the caller must complete and false. It returns nil if the cache is
+// disabled.
+func (c *responseCache) lookup(
+	userId user.Id,
+	name, key string,
+	fingerprint [sha256.Size]byte) (*cachedResponse, bool) {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ttl <= 0 || c.maxPerUser == 0 {
+		return nil, false
+	}
+	now := c.clock.Now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		c.sweep(now)
+	}
+	entries := c.users[userId]
+	for _, entry := range entries {
+		if entry.name == name && entry.key == key && now.Before(entry.expires) {
+			return entry, true
+		}
+	}
+	entry := &cachedResponse{
+		name:        name,
+		key:         key,
+		fingerprint: fingerprint,
+		expires:     now.Add(c.ttl),
+		done:        make(chan struct{}),
+	}
+	entries = append(entries, entry)
+	if uint(len(entries)) > c.maxPerUser {
+		entries = entries[uint(len(entries))-c.maxPerUser:]
+	}
+	c.users[userId] = entries
+	return entry, false
+}
+
+func (c *responseCache) remove(userId user.Id, entry *cachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var kept []*cachedResponse
+	for _, e := range c.users[userId] {
+		if e != entry {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		delete(c.users, userId)
+	} else {
+		c.users[userId] = kept
+	}
+}
+
+// sweep removes the expired responses and the users left without any.
+// This method should only be called while owning the cache's lock.
+func (c *responseCache) sweep(now time.Time) {
+	for userId, entries := range c.users {
+		// Entries are appended as they are created so the oldest come first.
+		i := 0
+		for i < len(entries) && !now.Before(entries[i].expires) {
+			i++
+		}
+		if i == len(entries) {
+			delete(c.users, userId)
+		} else {
+			c.users[userId] = entries[i:]
+		}
+	}
+	c.lastSweep = now
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"os"
 	"time"
 
 	"code.google.com/p/go.net/context"
@@ -13,7 +14,10 @@ import (
 	"github.com/opentarock/service-api/go/reqcontext"
 	"github.com/opentarock/service-api/go/service"
 	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+	"github.com/opentarock/service-lobby/config"
 	"github.com/opentarock/service-lobby/lobby"
+	"github.com/opentarock/service-lobby/util"
 	"gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -24,12 +28,66 @@ const (
 
 type lobbyServiceHandlers struct {
 	roomList *lobby.RoomList
+	config   *config.Manager
+	limiter  *rateLimiter
+	roles    *authz.MemoryRoleStore
+	policy   authz.Policy
+	auditLog AuditLog
+	// responses are the responses returned to retried requests.
+	responses *responseCache
 }
 
-func NewLobbyServiceHandlers(notifyClient client.NotifyClient) *lobbyServiceHandlers {
-	return &lobbyServiceHandlers{
-		roomList: lobby.NewRoomList(notifyClient),
+func NewLobbyServiceHandlers(notifyClient client.NotifyClient, conf *config.Manager) *lobbyServiceHandlers {
+	s := &lobbyServiceHandlers{
+		roomList:  lobby.NewRoomList(notifyClient),
+		config:    conf,
+		limiter:   newRateLimiter(util.RealClock()),
+		roles:     authz.NewMemoryRoleStore(),
+		policy:    authz.DefaultPolicy(),
+		auditLog:  NewJsonAuditLog(os.Stderr),
+		responses: newResponseCache(util.RealClock()),
 	}
+	s.roomList.ManagesRooms = s.managesRooms
+	s.applyConfig(conf.Get())
+	conf.OnChange(s.applyConfig)
+	return s
+}
+
+// applyConfig applies the settings that can be changed while the service is
+// running.
+func (s *lobbyServiceHandlers) applyConfig(c *config.Config) {
+	s.roomList.SetLimits(lobby.Limits{
+		MaxRooms:          c.MaxRooms,
+		MaxPlayers:        c.MaxPlayers,
+		ReadyTimeout:      c.ReadyTimeout.Get(),
+		IdleTtl:           c.RoomIdleTtl.Get(),
+		InProgressIdleTtl: c.GameIdleTtl.Get(),
+		IdleWarning:       c.IdleWarning.Get(),
+		HeartbeatTimeout:  c.HeartbeatTimeout.Get(),
+		DisconnectGrace:   c.DisconnectGrace.Get(),
+		MaxNameLength:     c.MaxRoomNameLength,
+		MaxMessageLength:  c.MaxChatMessageLength,
+		ChatHistory:       c.ChatHistory,
+		VoteTimeout:       c.VoteTimeout.Get(),
+		VoteThreshold:     c.VoteThreshold,
+		KickCooldown:      c.KickCooldown.Get(),
+	})
+	s.limiter.setLimits(c)
+	s.responses.setLimits(c.IdempotencyTtl.Get(), c.MaxIdempotentResponses)
+	s.roles.Replace(c.Roles)
+}
+
+// SetNameFilter sets the filter of room names with words that are not
+// allowed. It must be called before the handlers start receiving requests.
+func (s *lobbyServiceHandlers) SetNameFilter(blocked func(name string) bool) {
+	s.roomList.BlocksName = blocked
+}
+
+// SetMessageModerator sets the moderation hook that can change or reject
+// chat messages. It must be called before the handlers start receiving
+// requests.
+func (s *lobbyServiceHandlers) SetMessageModerator(moderate func(userId user.Id, roomId lobby.RoomId, text string) (string, bool)) {
+	s.roomList.ModerateMessage = moderate
 }
 
 func (s *lobbyServiceHandlers) CreateRoomHandler() service.MessageHandler {
@@ -49,15 +107,13 @@ func (s *lobbyServiceHandlers) CreateRoomHandler() service.MessageHandler {
 		if !ok {
 			return missingAuthHeaderError(logger)
 		}
-
-		room, errCode := s.roomList.CreateRoom(user.Id(auth.GetUserId()), request.GetName(), request.GetOptions())
-		response := proto_lobby.CreateRoomResponse{
-			Room: room,
-		}
-		if room == nil {
-			response.ErrorCode = errCode.Enum()
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "create_room"); err != nil {
+			return permissionDeniedError(logger, userId)
 		}
-		return proto.CompositeMessage{Message: &response}
+
+		response, _ := s.createRoom(logger, userId, &request)
+		return proto.CompositeMessage{Message: response}
 	})
 }
 
@@ -78,16 +134,13 @@ func (s *lobbyServiceHandlers) JoinRoomHandler() service.MessageHandler {
 		if !ok {
 			return missingAuthHeaderError(logger)
 		}
-
-		room, errCode := s.roomList.JoinRoom(user.Id(auth.GetUserId()), lobby.RoomId(request.GetRoomId()))
-
-		response := proto_lobby.JoinRoomResponse{
-			Room: room,
-		}
-		if room == nil {
-			response.ErrorCode = errCode.Enum()
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "join_room"); err != nil {
+			return permissionDeniedError(logger, userId)
 		}
-		return proto.CompositeMessage{Message: &response}
+
+		response, _ := s.joinRoom(logger, userId, &request)
+		return proto.CompositeMessage{Message: response}
 	})
 }
 
@@ -108,14 +161,13 @@ func (s *lobbyServiceHandlers) LeaveRoomHandler() service.MessageHandler {
 		if !ok {
 			return missingAuthHeaderError(logger)
 		}
-
-		success, errCode := s.roomList.LeaveRoom(user.Id(auth.GetUserId()))
-
-		response := proto_lobby.LeaveRoomResponse{}
-		if !success {
-			response.ErrorCode = errCode.Enum()
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "leave_room"); err != nil {
+			return permissionDeniedError(logger, userId)
 		}
-		return proto.CompositeMessage{Message: &response}
+
+		response, _ := s.leaveRoom(logger, userId, &request)
+		return proto.CompositeMessage{Message: response}
 	})
 }
 
@@ -136,11 +188,13 @@ func (s *lobbyServiceHandlers) ListRoomsHandler() service.MessageHandler {
 		if !ok {
 			return missingAuthHeaderError(logger)
 		}
-
-		response := proto_lobby.ListRoomsResponse{
-			Rooms: s.roomList.ListRoomsExcluding(user.Id(auth.GetUserId())),
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "list_rooms"); err != nil {
+			return permissionDeniedError(logger, userId)
 		}
-		return proto.CompositeMessage{Message: &response}
+
+		response, _ := s.listRooms(logger, userId, &request)
+		return proto.CompositeMessage{Message: response}
 	})
 }
 
@@ -157,16 +211,16 @@ func (s *lobbyServiceHandlers) RoomInfoHandler() service.MessageHandler {
 			logger.Error("Malformed request", "error", err)
 			return proto.CompositeMessage{Message: proto_errors.NewMalformedMessageUnpack()}
 		}
-		response := proto_lobby.RoomInfoResponse{
-			Room: s.roomList.GetRoom(lobby.RoomId(request.GetRoomId())),
+		// Room info doesn't require a user but users making the request must
+		// be allowed to.
+		if auth, ok := reqcontext.AuthFromContext(ctx); ok {
+			userId := user.Id(auth.GetUserId())
+			if err := s.authorize(userId, "room_info"); err != nil {
+				return permissionDeniedError(logger, userId)
+			}
 		}
-		if response.Room == nil {
-			logger.Info("Room does not exist", "room_id", request.GetRoomId())
-			response.ErrorCode = proto_lobby.RoomInfoResponse_ROOM_DOES_NOT_EXIST.Enum()
-		} else {
-			logger.Info("Getting room info", "room_id", request.GetRoomId())
-		}
-		return proto.CompositeMessage{Message: &response}
+		response, _ := s.roomInfo(logger, &request)
+		return proto.CompositeMessage{Message: response}
 	})
 }
 
@@ -187,23 +241,286 @@ func (s *lobbyServiceHandlers) StartGameHandler() service.MessageHandler {
 		if !ok {
 			return missingAuthHeaderError(logger)
 		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "start_game"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
 
-		err = s.roomList.StartGame(user.Id(auth.GetUserId()))
-		var errResponse *proto_lobby.StartGameResponse_ErrorCode
-		if err == lobby.ErrNotInRoom {
-			errResponse = proto_lobby.StartGameResponse_NOT_IN_ROOM.Enum()
-		} else if err == lobby.ErrNotOwner {
-			errResponse = proto_lobby.StartGameResponse_NOT_OWNER.Enum()
-		} else if err == lobby.ErrAlreadyStarted {
-			errResponse = proto_lobby.StartGameResponse_ALREADY_STARTED.Enum()
-		} else if err != nil {
-			logger.Error("Unknown start game error", "error", err)
+		response, err := s.startGame(logger, userId, &request)
+		if err != nil {
 			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
 		}
-		response := proto_lobby.StartGameResponse{
-			ErrorCode: errResponse,
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) ForceStartGameHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.ForceStartGameRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
 		}
-		return proto.CompositeMessage{Message: &response}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "force_start_game"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.forceStartGame(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) CancelStartHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.CancelStartRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "cancel_start"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.cancelStart(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) UpdateRoomHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.UpdateRoomRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "update_room"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.updateRoom(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) SendRoomMessageHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.SendRoomMessageRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "send_room_message"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.sendRoomMessage(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) MuteMemberHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.MuteMemberRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "mute_member"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.muteMember(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) StartVoteHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.StartVoteRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "start_vote"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.startVote(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) CastVoteHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.CastVoteRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "cast_vote"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.castVote(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) GetMyRoomHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.GetMyRoomRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "get_my_room"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.getMyRoom(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) HeartbeatHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.HeartbeatRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "heartbeat"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.heartbeat(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
 	})
 }
 
@@ -224,21 +541,200 @@ func (s *lobbyServiceHandlers) PlayerReadyHandler() service.MessageHandler {
 		if !ok {
 			return missingAuthHeaderError(logger)
 		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "player_ready"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
 
-		err = s.roomList.PlayerReady(user.Id(auth.GetUserId()), request.GetState())
-		var errResponse *proto_lobby.PlayerReadyResponse_ErrorCode
-		if err == lobby.ErrNotInRoom {
-			errResponse = proto_lobby.PlayerReadyResponse_NOT_IN_ROOM.Enum()
-		} else if err == lobby.ErrUnexpectedReady {
-			errResponse = proto_lobby.PlayerReadyResponse_UNEXPECTED.Enum()
-		} else if err == lobby.ErrInvalidStateString {
-			errResponse = proto_lobby.PlayerReadyResponse_INVALID_STATE.Enum()
-		} else if err != nil {
-			logger.Error("Unknown player ready error", "error", err)
+		response, err := s.playerReady(logger, userId, &request)
+		if err != nil {
 			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
 		}
-		response := proto_lobby.PlayerReadyResponse{
-			ErrorCode: errResponse,
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) AdminListRoomsHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.AdminListRoomsRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "admin_list_rooms"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.adminListRooms(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) AdminCloseRoomHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.AdminCloseRoomRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "admin_close_room"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.adminCloseRoom(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) AdminRemovePlayerHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.AdminRemovePlayerRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "admin_remove_player"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.adminRemovePlayer(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) AdminCancelStartHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.AdminCancelStartRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "admin_cancel_start"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.adminCancelStart(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) AdminMovePlayerHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.AdminMovePlayerRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "admin_move_player"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response, err := s.adminMovePlayer(logger, userId, &request)
+		if err != nil {
+			return proto.CompositeMessage{Message: proto_errors.NewInternalErrorUnknown()}
+		}
+		return proto.CompositeMessage{Message: response}
+	})
+}
+
+func (s *lobbyServiceHandlers) ReloadConfigHandler() service.MessageHandler {
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+
+		var request proto_lobby.ReloadConfigRequest
+		err := msg.Unmarshal(&request)
+		if err != nil {
+			return newMalformedMessageError(logger, request.GetMessageType(), err)
+		}
+
+		auth, ok := reqcontext.AuthFromContext(ctx)
+		if !ok {
+			return missingAuthHeaderError(logger)
+		}
+		userId := user.Id(auth.GetUserId())
+		if err := s.authorize(userId, "reload_config"); err != nil {
+			return permissionDeniedError(logger, userId)
+		}
+
+		response := proto_lobby.ReloadConfigResponse{}
+		restart, err := s.config.Reload()
+		s.audit(AuditEntry{Admin: userId, Action: "reload_config", Error: errorString(err)})
+		if err != nil {
+			logger.Error("Invalid configuration", "error", err)
+			response.ErrorCode = proto_lobby.ReloadConfigResponse_INVALID_CONFIG.Enum()
+		} else {
+			logger.Info("Configuration reloaded", "restart_required", restart)
+			response.RestartRequired = restart
 		}
 		return proto.CompositeMessage{Message: &response}
 	})
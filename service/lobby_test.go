@@ -0,0 +1,63 @@
+package service_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_errors"
+	"github.com/opentarock/service-api/go/proto_headers"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/service"
+)
+
+// request encodes a nanomsg request from the user.
+func request(t *testing.T, msg proto.ProtobufMessage, userId user.Id) *proto.Message {
+	request, err := proto.Marshal(msg, &proto_headers.AuthorizationHeader{
+		UserId: pbuf.String(userId.String()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestReloadConfigRequiresAdmin(t *testing.T) {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	handlers.SetAuditLog(service.NewJsonAuditLog(ioutil.Discard))
+	handlers.Roles().SetRole("admin", authz.RoleAdmin)
+	handlers.Roles().SetRole("3", authz.RoleModerator)
+	reload := handlers.ReloadConfigHandler()
+
+	response := reload.HandleMessage(request(t, &proto_lobby.ReloadConfigRequest{}, "1"))
+	assert.IsType(t, &proto_errors.ErrorMessage{}, response.Message, "Players can't reload")
+	response = reload.HandleMessage(request(t, &proto_lobby.ReloadConfigRequest{}, "3"))
+	assert.IsType(t, &proto_errors.ErrorMessage{}, response.Message, "Moderators can't reload")
+	response = reload.HandleMessage(request(t, &proto_lobby.ReloadConfigRequest{}, "admin"))
+	assert.IsType(t, &proto_lobby.ReloadConfigResponse{}, response.Message)
+}
+
+func TestRoomInfoRefusesBannedUsers(t *testing.T) {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	handlers.Roles().SetRole("2", authz.RoleBanned)
+	roomInfo := handlers.RoomInfoHandler()
+
+	response := roomInfo.HandleMessage(request(t, &proto_lobby.RoomInfoRequest{RoomId: pbuf.String("room")}, "1"))
+	assert.IsType(t, &proto_lobby.RoomInfoResponse{}, response.Message)
+	response = roomInfo.HandleMessage(request(t, &proto_lobby.RoomInfoRequest{RoomId: pbuf.String("room")}, "2"))
+	assert.IsType(t, &proto_errors.ErrorMessage{}, response.Message)
+}
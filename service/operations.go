@@ -0,0 +1,546 @@
+package service
+
+import (
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+// Operations implement the lobby requests independently of the transport
+// the request arrived with so every transport shares the same validation and
+// error code mapping.
+// A returned error means the request failed unexpectedly and the transport
+// should respond with an internal error.
+
+// operation describes a lobby request for transports that dispatch requests
+// by name.
+type operation struct {
+	name string
+	// requireAuth is false if the request can be made without a user.
+	requireAuth bool
+	newRequest  func() proto.ProtobufMessage
+	run         func(logger log15.Logger, userId user.Id, request proto.ProtobufMessage) (proto.ProtobufMessage, error)
+}
+
+// operations returns all the lobby requests available to transports.
+// Requests are subject to the rate limits and the authorization policy.
+// New operations also need a method in the gRPC service definition in
+// lobby.proto.
+func (s *lobbyServiceHandlers) operations() []operation {
+	ops := []operation{
+		{"create_room", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.CreateRoomRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.createRoom(logger, userId, r.(*proto_lobby.CreateRoomRequest))
+			}},
+		{"join_room", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.JoinRoomRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.joinRoom(logger, userId, r.(*proto_lobby.JoinRoomRequest))
+			}},
+		{"leave_room", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.LeaveRoomRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.leaveRoom(logger, userId, r.(*proto_lobby.LeaveRoomRequest))
+			}},
+		{"list_rooms", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.ListRoomsRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.listRooms(logger, userId, r.(*proto_lobby.ListRoomsRequest))
+			}},
+		{"room_info", false,
+			func() proto.ProtobufMessage { return new(proto_lobby.RoomInfoRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.roomInfo(logger, r.(*proto_lobby.RoomInfoRequest))
+			}},
+		{"start_game", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.StartGameRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.startGame(logger, userId, r.(*proto_lobby.StartGameRequest))
+			}},
+		{"force_start_game", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.ForceStartGameRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.forceStartGame(logger, userId, r.(*proto_lobby.ForceStartGameRequest))
+			}},
+		{"cancel_start", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.CancelStartRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.cancelStart(logger, userId, r.(*proto_lobby.CancelStartRequest))
+			}},
+		{"update_room", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.UpdateRoomRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.updateRoom(logger, userId, r.(*proto_lobby.UpdateRoomRequest))
+			}},
+		{"send_room_message", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.SendRoomMessageRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.sendRoomMessage(logger, userId, r.(*proto_lobby.SendRoomMessageRequest))
+			}},
+		{"mute_member", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.MuteMemberRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.muteMember(logger, userId, r.(*proto_lobby.MuteMemberRequest))
+			}},
+		{"start_vote", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.StartVoteRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.startVote(logger, userId, r.(*proto_lobby.StartVoteRequest))
+			}},
+		{"cast_vote", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.CastVoteRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.castVote(logger, userId, r.(*proto_lobby.CastVoteRequest))
+			}},
+		{"get_my_room", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.GetMyRoomRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.getMyRoom(logger, userId, r.(*proto_lobby.GetMyRoomRequest))
+			}},
+		{"heartbeat", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.HeartbeatRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.heartbeat(logger, userId, r.(*proto_lobby.HeartbeatRequest))
+			}},
+		{"player_ready", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.PlayerReadyRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.playerReady(logger, userId, r.(*proto_lobby.PlayerReadyRequest))
+			}},
+		{"admin_list_rooms", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.AdminListRoomsRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.adminListRooms(logger, userId, r.(*proto_lobby.AdminListRoomsRequest))
+			}},
+		{"admin_close_room", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.AdminCloseRoomRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.adminCloseRoom(logger, userId, r.(*proto_lobby.AdminCloseRoomRequest))
+			}},
+		{"admin_remove_player", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.AdminRemovePlayerRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.adminRemovePlayer(logger, userId, r.(*proto_lobby.AdminRemovePlayerRequest))
+			}},
+		{"admin_cancel_start", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.AdminCancelStartRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.adminCancelStart(logger, userId, r.(*proto_lobby.AdminCancelStartRequest))
+			}},
+		{"admin_move_player", true,
+			func() proto.ProtobufMessage { return new(proto_lobby.AdminMovePlayerRequest) },
+			func(logger log15.Logger, userId user.Id, r proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+				return s.adminMovePlayer(logger, userId, r.(*proto_lobby.AdminMovePlayerRequest))
+			}},
+	}
+	for i := range ops {
+		ops[i] = s.rateLimited(s.authorized(ops[i]))
+	}
+	return ops
+}
+
+func (s *lobbyServiceHandlers) createRoom(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.CreateRoomRequest) (*proto_lobby.CreateRoomResponse, error) {
+
+	response, err := s.responses.do(userId, "create_room", request.GetIdempotencyKey(), request,
+		func() (proto.ProtobufMessage, error) {
+			room, errCode := s.roomList.CreateRoom(userId, request.GetName(), request.GetOptions())
+			response := &proto_lobby.CreateRoomResponse{
+				Room: room,
+			}
+			if room == nil {
+				response.ErrorCode = errCode.Enum()
+			}
+			return response, nil
+		})
+	if err == ErrIdempotencyKeyReused {
+		logger.Warn("Idempotency key reused", "key", request.GetIdempotencyKey())
+		return &proto_lobby.CreateRoomResponse{
+			ErrorCode: proto_lobby.CreateRoomResponse_IDEMPOTENCY_KEY_REUSED.Enum(),
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return response.(*proto_lobby.CreateRoomResponse), nil
+}
+
+func (s *lobbyServiceHandlers) joinRoom(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.JoinRoomRequest) (*proto_lobby.JoinRoomResponse, error) {
+
+	response, err := s.responses.do(userId, "join_room", request.GetIdempotencyKey(), request,
+		func() (proto.ProtobufMessage, error) {
+			room, errCode := s.roomList.JoinRoomWithPassword(
+				userId, lobby.RoomId(request.GetRoomId()), request.GetPassword())
+			response := &proto_lobby.JoinRoomResponse{
+				Room: room,
+			}
+			if room == nil {
+				response.ErrorCode = errCode.Enum()
+			}
+			return response, nil
+		})
+	if err == ErrIdempotencyKeyReused {
+		logger.Warn("Idempotency key reused", "key", request.GetIdempotencyKey())
+		return &proto_lobby.JoinRoomResponse{
+			ErrorCode: proto_lobby.JoinRoomResponse_IDEMPOTENCY_KEY_REUSED.Enum(),
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return response.(*proto_lobby.JoinRoomResponse), nil
+}
+
+func (s *lobbyServiceHandlers) leaveRoom(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.LeaveRoomRequest) (*proto_lobby.LeaveRoomResponse, error) {
+
+	success, errCode := s.roomList.LeaveRoom(userId)
+	response := &proto_lobby.LeaveRoomResponse{}
+	if !success {
+		response.ErrorCode = errCode.Enum()
+	}
+	return response, nil
+}
+
+func (s *lobbyServiceHandlers) listRooms(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.ListRoomsRequest) (*proto_lobby.ListRoomsResponse, error) {
+
+	rooms, version, changed := s.roomList.ListRoomsChangedSince(userId, request.GetIfChangedSince())
+	response := &proto_lobby.ListRoomsResponse{
+		Rooms:   rooms,
+		Version: pbuf.Uint64(version),
+	}
+	if !changed {
+		response.NotModified = pbuf.Bool(true)
+	}
+	return response, nil
+}
+
+// roomInfo does not require an authenticated user.
+func (s *lobbyServiceHandlers) roomInfo(
+	logger log15.Logger,
+	request *proto_lobby.RoomInfoRequest) (*proto_lobby.RoomInfoResponse, error) {
+
+	response := &proto_lobby.RoomInfoResponse{
+		Room: s.roomList.GetRoom(lobby.RoomId(request.GetRoomId())),
+	}
+	if response.Room == nil {
+		logger.Info("Room does not exist", "room_id", request.GetRoomId())
+		response.ErrorCode = proto_lobby.RoomInfoResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if response.Room.GetVersion() <= request.GetIfChangedSince() {
+		logger.Info("Room not modified", "room_id", request.GetRoomId(), "version", response.Room.GetVersion())
+		response.Room = nil
+		response.NotModified = pbuf.Bool(true)
+	} else {
+		logger.Info("Getting room info", "room_id", request.GetRoomId())
+	}
+	return response, nil
+}
+
+func (s *lobbyServiceHandlers) startGame(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.StartGameRequest) (*proto_lobby.StartGameResponse, error) {
+
+	err := s.roomList.StartGame(userId, lobby.RoomId(request.GetRoomId()), request.GetExpectedVersion())
+	var errResponse *proto_lobby.StartGameResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.StartGameResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.StartGameResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrNotOwner {
+		errResponse = proto_lobby.StartGameResponse_NOT_OWNER.Enum()
+	} else if err == lobby.ErrAlreadyStarted {
+		errResponse = proto_lobby.StartGameResponse_ALREADY_STARTED.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.StartGameResponse_VERSION_CONFLICT.Enum()
+	} else if err != nil {
+		logger.Error("Unknown start game error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.StartGameResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) forceStartGame(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.ForceStartGameRequest) (*proto_lobby.ForceStartGameResponse, error) {
+
+	err := s.roomList.ForceStart(userId, lobby.RoomId(request.GetRoomId()), request.GetExpectedVersion())
+	var errResponse *proto_lobby.ForceStartGameResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.ForceStartGameResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.ForceStartGameResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrNotOwner {
+		errResponse = proto_lobby.ForceStartGameResponse_NOT_OWNER.Enum()
+	} else if err == lobby.ErrNotStarting {
+		errResponse = proto_lobby.ForceStartGameResponse_NOT_STARTING.Enum()
+	} else if err == lobby.ErrForceStartNotAllowed {
+		errResponse = proto_lobby.ForceStartGameResponse_NOT_ALLOWED.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.ForceStartGameResponse_VERSION_CONFLICT.Enum()
+	} else if err != nil {
+		logger.Error("Unknown force start game error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.ForceStartGameResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) cancelStart(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.CancelStartRequest) (*proto_lobby.CancelStartResponse, error) {
+
+	err := s.roomList.CancelStart(userId, lobby.RoomId(request.GetRoomId()), request.GetExpectedVersion())
+	var errResponse *proto_lobby.CancelStartResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.CancelStartResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.CancelStartResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrNotOwner {
+		errResponse = proto_lobby.CancelStartResponse_NOT_OWNER.Enum()
+	} else if err == lobby.ErrNotStarting {
+		errResponse = proto_lobby.CancelStartResponse_NOT_STARTING.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.CancelStartResponse_VERSION_CONFLICT.Enum()
+	} else if err != nil {
+		logger.Error("Unknown cancel start error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.CancelStartResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) updateRoom(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.UpdateRoomRequest) (*proto_lobby.UpdateRoomResponse, error) {
+
+	room, err := s.roomList.UpdateRoom(userId, lobby.RoomId(request.GetRoomId()), request.GetName(), request.GetOptions(), request.GetExpectedVersion())
+	var errResponse *proto_lobby.UpdateRoomResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.UpdateRoomResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.UpdateRoomResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrNotOwner {
+		errResponse = proto_lobby.UpdateRoomResponse_NOT_OWNER.Enum()
+	} else if err == lobby.ErrGameInProgress {
+		errResponse = proto_lobby.UpdateRoomResponse_GAME_IN_PROGRESS.Enum()
+	} else if err == lobby.ErrInvalidMaxPlayers {
+		errResponse = proto_lobby.UpdateRoomResponse_INVALID_MAX_PLAYERS.Enum()
+	} else if err == lobby.ErrTooManyPlayers {
+		errResponse = proto_lobby.UpdateRoomResponse_TOO_MANY_PLAYERS.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.UpdateRoomResponse_VERSION_CONFLICT.Enum()
+	} else if err == lobby.ErrNameEmpty {
+		errResponse = proto_lobby.UpdateRoomResponse_NAME_EMPTY.Enum()
+	} else if err == lobby.ErrNameTooLong {
+		errResponse = proto_lobby.UpdateRoomResponse_NAME_TOO_LONG.Enum()
+	} else if err == lobby.ErrNameInvalidCharacters {
+		errResponse = proto_lobby.UpdateRoomResponse_NAME_INVALID_CHARACTERS.Enum()
+	} else if err == lobby.ErrNameConfusable {
+		errResponse = proto_lobby.UpdateRoomResponse_NAME_CONFUSABLE.Enum()
+	} else if err == lobby.ErrNameBlocked {
+		errResponse = proto_lobby.UpdateRoomResponse_NAME_BLOCKED.Enum()
+	} else if err != nil {
+		logger.Error("Unknown update room error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.UpdateRoomResponse{
+		Room:      room,
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) playerReady(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.PlayerReadyRequest) (*proto_lobby.PlayerReadyResponse, error) {
+
+	err := s.roomList.PlayerReady(userId, request.GetState())
+	var errResponse *proto_lobby.PlayerReadyResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.PlayerReadyResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrUnexpectedReady {
+		errResponse = proto_lobby.PlayerReadyResponse_UNEXPECTED.Enum()
+	} else if err == lobby.ErrInvalidStateString {
+		errResponse = proto_lobby.PlayerReadyResponse_INVALID_STATE.Enum()
+	} else if err != nil {
+		logger.Error("Unknown player ready error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.PlayerReadyResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) sendRoomMessage(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.SendRoomMessageRequest) (*proto_lobby.SendRoomMessageResponse, error) {
+
+	msg, err := s.roomList.SendRoomMessage(userId, request.GetText())
+	var errResponse *proto_lobby.SendRoomMessageResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.SendRoomMessageResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrMessageEmpty {
+		errResponse = proto_lobby.SendRoomMessageResponse_EMPTY.Enum()
+	} else if err == lobby.ErrMessageTooLong {
+		errResponse = proto_lobby.SendRoomMessageResponse_TOO_LONG.Enum()
+	} else if err == lobby.ErrMuted {
+		errResponse = proto_lobby.SendRoomMessageResponse_MUTED.Enum()
+	} else if err == lobby.ErrMessageRejected {
+		errResponse = proto_lobby.SendRoomMessageResponse_REJECTED.Enum()
+	} else if err != nil {
+		logger.Error("Unknown send room message error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.SendRoomMessageResponse{
+		Message:   msg,
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) muteMember(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.MuteMemberRequest) (*proto_lobby.MuteMemberResponse, error) {
+
+	err := s.roomList.MuteMember(userId, lobby.RoomId(request.GetRoomId()), user.Id(request.GetPlayer()), request.GetMuted())
+	var errResponse *proto_lobby.MuteMemberResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.MuteMemberResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrRoomNotFound {
+		errResponse = proto_lobby.MuteMemberResponse_ROOM_DOES_NOT_EXIST.Enum()
+	} else if err == lobby.ErrNotOwner {
+		errResponse = proto_lobby.MuteMemberResponse_NOT_OWNER.Enum()
+	} else if err == lobby.ErrPlayerNotInRoom {
+		errResponse = proto_lobby.MuteMemberResponse_PLAYER_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrMuteSelf {
+		errResponse = proto_lobby.MuteMemberResponse_INVALID_TARGET.Enum()
+	} else if err != nil {
+		logger.Error("Unknown mute member error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.MuteMemberResponse{
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) startVote(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.StartVoteRequest) (*proto_lobby.StartVoteResponse, error) {
+
+	vote, err := s.roomList.StartVote(
+		userId,
+		lobby.VoteKindFromProto(request.GetKind()),
+		user.Id(request.GetTarget()),
+		request.GetExpectedVersion())
+	var errResponse *proto_lobby.StartVoteResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.StartVoteResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrVoteInProgress {
+		errResponse = proto_lobby.StartVoteResponse_VOTE_IN_PROGRESS.Enum()
+	} else if err == lobby.ErrInvalidVoteTarget {
+		errResponse = proto_lobby.StartVoteResponse_INVALID_TARGET.Enum()
+	} else if err == lobby.ErrNotEnoughVoters {
+		errResponse = proto_lobby.StartVoteResponse_NOT_ENOUGH_VOTERS.Enum()
+	} else if err == lobby.ErrGameStartInProgress {
+		errResponse = proto_lobby.StartVoteResponse_GAME_STARTING.Enum()
+	} else if err == lobby.ErrAlreadyStarted {
+		errResponse = proto_lobby.StartVoteResponse_ALREADY_STARTED.Enum()
+	} else if err == lobby.ErrVersionConflict {
+		errResponse = proto_lobby.StartVoteResponse_VERSION_CONFLICT.Enum()
+	} else if err != nil {
+		logger.Error("Unknown start vote error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.StartVoteResponse{
+		Vote:      vote,
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) castVote(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.CastVoteRequest) (*proto_lobby.CastVoteResponse, error) {
+
+	vote, err := s.roomList.CastVote(userId, request.GetVoteId(), request.GetYes())
+	var errResponse *proto_lobby.CastVoteResponse_ErrorCode
+	if err == lobby.ErrNotInRoom {
+		errResponse = proto_lobby.CastVoteResponse_NOT_IN_ROOM.Enum()
+	} else if err == lobby.ErrNoVote {
+		errResponse = proto_lobby.CastVoteResponse_NO_VOTE.Enum()
+	} else if err == lobby.ErrUnknownUser {
+		errResponse = proto_lobby.CastVoteResponse_NOT_VOTER.Enum()
+	} else if err == lobby.ErrAlreadyVoted {
+		errResponse = proto_lobby.CastVoteResponse_ALREADY_VOTED.Enum()
+	} else if err != nil {
+		logger.Error("Unknown cast vote error", "error", err)
+		return nil, err
+	}
+	return &proto_lobby.CastVoteResponse{
+		Vote:      vote,
+		ErrorCode: errResponse,
+	}, nil
+}
+
+func (s *lobbyServiceHandlers) heartbeat(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.HeartbeatRequest) (*proto_lobby.HeartbeatResponse, error) {
+
+	s.roomList.Heartbeat(userId)
+	return &proto_lobby.HeartbeatResponse{}, nil
+}
+
+func (s *lobbyServiceHandlers) getMyRoom(
+	logger log15.Logger,
+	userId user.Id,
+	request *proto_lobby.GetMyRoomRequest) (*proto_lobby.GetMyRoomResponse, error) {
+
+	status, err := s.roomList.GetMyRoom(userId)
+	if err == lobby.ErrNotInRoom {
+		return &proto_lobby.GetMyRoomResponse{
+			ErrorCode: proto_lobby.GetMyRoomResponse_NOT_IN_ROOM.Enum(),
+		}, nil
+	} else if err != nil {
+		logger.Error("Unknown get my room error", "error", err)
+		return nil, err
+	}
+	response := &proto_lobby.GetMyRoomResponse{
+		Room:   status.Room,
+		Status: proto_lobby.GetMyRoomResponse_NOT_STARTED.Enum(),
+		Vote:   status.Vote,
+	}
+	if status.Starting {
+		response.Status = proto_lobby.GetMyRoomResponse_STARTING.Enum()
+		response.ReadyState = pbuf.String(status.State)
+		response.Ready = pbuf.Bool(status.Ready)
+	} else if status.InProgress {
+		// The lobby doesn't assign game servers so there are no connection
+		// details to resume the game with and Game is left unset.
+		response.Status = proto_lobby.GetMyRoomResponse_IN_PROGRESS.Enum()
+	}
+	return response, nil
+}
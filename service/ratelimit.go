@@ -0,0 +1,189 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"code.google.com/p/go.net/context"
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/proto_errors"
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/reqcontext"
+	"github.com/opentarock/service-api/go/service"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/util"
+)
+
+// ErrRateLimited is returned by an operation if the user made too many
+// requests or the service is handling too many requests at the same time.
+var ErrRateLimited = errors.New("Rate limit exceeded")
+
+// limiterSweepInterval is how often buckets of users that went idle are
+// removed.
+const limiterSweepInterval = time.Minute
+
+// rateLimiter limits the requests of every user with a token bucket per
+// request name and caps the number of requests handled concurrently.
+// Requests without a user only count towards the concurrency cap, a bucket
+// shared by all of them would let one client lock out everyone else.
+type rateLimiter struct {
+	defaultLimit  config.RateLimit
+	limits        map[string]config.RateLimit
+	maxConcurrent uint
+	concurrent    uint
+	buckets       map[bucketKey]*util.TokenBucket
+	clock         util.Clock
+	lastSweep     time.Time
+	lock          *sync.Mutex
+}
+
+type bucketKey struct {
+	userId user.Id
+	name   string
+}
+
+func newRateLimiter(clock util.Clock) *rateLimiter {
+	return &rateLimiter{
+		limits:    make(map[string]config.RateLimit),
+		buckets:   make(map[bucketKey]*util.TokenBucket),
+		clock:     clock,
+		lastSweep: clock.Now(),
+		lock:      new(sync.Mutex),
+	}
+}
+
+// setLimits applies the rate limit settings. Users keep their buckets of
+// requests whose limit did not change and start with full buckets under the
+// new limits otherwise.
+func (l *rateLimiter) setLimits(c *config.Config) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	old := make(map[string]config.RateLimit)
+	for key := range l.buckets {
+		if _, ok := old[key.name]; !ok {
+			old[key.name] = l.limit(key.name)
+		}
+	}
+	l.defaultLimit = c.DefaultRateLimit
+	l.limits = c.RateLimits
+	l.maxConcurrent = c.MaxConcurrentRequests
+	for key := range l.buckets {
+		if l.limit(key.name) != old[key.name] {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limit returns the rate limit of requests with the name.
+// This method should only be called while owning the limiter's lock.
+func (l *rateLimiter) limit(name string) config.RateLimit {
+	if limit, ok := l.limits[name]; ok {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+// acquire takes a token from the user's bucket for the request and a slot
+// for handling it. Requests without a user only take a slot. The returned
+// function must be called once the request is handled.
+func (l *rateLimiter) acquire(userId user.Id, name string) (func(), error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.clock.Now()
+	if now.Sub(l.lastSweep) >= limiterSweepInterval {
+		l.sweep(now)
+	}
+	if l.maxConcurrent != 0 && l.concurrent >= l.maxConcurrent {
+		return nil, ErrRateLimited
+	}
+	limit := l.limit(name)
+	if limit.Rate > 0 && userId != "" {
+		key := bucketKey{userId, name}
+		bucket, ok := l.buckets[key]
+		if !ok {
+			bucket = util.NewTokenBucket(limit.Rate, limit.Burst, now)
+			l.buckets[key] = bucket
+		}
+		if !bucket.Take(now) {
+			return nil, ErrRateLimited
+		}
+	}
+	l.concurrent++
+	return l.release, nil
+}
+
+func (l *rateLimiter) release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.concurrent--
+}
+
+// sweep removes the buckets that have refilled completely, they are the same
+// as the new bucket a user gets on the next request.
+// This method should only be called while owning the limiter's lock.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.IsFull(now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimited wraps the run function of an operation with the rate limits.
+func (s *lobbyServiceHandlers) rateLimited(op operation) operation {
+	run := op.run
+	op.run = func(logger log15.Logger, userId user.Id, request proto.ProtobufMessage) (proto.ProtobufMessage, error) {
+		release, err := s.limiter.acquire(userId, op.name)
+		if err != nil {
+			logger.Warn("Request rate limited", "user_id", userId, "request", op.name)
+			return nil, err
+		}
+		defer release()
+		return run(logger, userId, request)
+	}
+	return op
+}
+
+// RateLimited wraps the nanomsg handler of requests of type msgType with the
+// rate limits. Requests over the limit receive a RateLimited error.
+func (s *lobbyServiceHandlers) RateLimited(msgType proto.Type, handler service.MessageHandler) service.MessageHandler {
+	name := s.requestName(msgType)
+	return service.MessageHandlerFunc(func(msg *proto.Message) proto.CompositeMessage {
+		ctx, cancel := reqcontext.WithRequest(context.Background(), msg, defaultRequestTimeout)
+		defer cancel()
+
+		var userId user.Id
+		if auth, ok := reqcontext.AuthFromContext(ctx); ok {
+			userId = user.Id(auth.GetUserId())
+		}
+		release, err := s.limiter.acquire(userId, name)
+		if err != nil {
+			logger := reqcontext.ContextLogger(ctx, "service_name", serviceName)
+			logger.Warn("Request rate limited", "user_id", userId, "request", name)
+			return proto.CompositeMessage{Message: proto_errors.NewRateLimited()}
+		}
+		defer release()
+		return handler.HandleMessage(msg)
+	})
+}
+
+// requestName returns the name of the operation handling requests of type
+// msgType, the same name is used by the gateways and in the rate limits
+// configuration.
+func (s *lobbyServiceHandlers) requestName(msgType proto.Type) string {
+	for _, op := range s.operations() {
+		if op.newRequest().GetMessageType() == msgType {
+			return op.name
+		}
+	}
+	switch msgType {
+	case proto_lobby.ReloadConfigRequestMessage:
+		return "reload_config"
+	}
+	return ""
+}
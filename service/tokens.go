@@ -0,0 +1,50 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opentarock/service-api/go/user"
+)
+
+// AccessTokens maps the bearer tokens of users of the gateways to their ids.
+type AccessTokens struct {
+	users map[string]user.Id
+}
+
+// LoadAccessTokens reads the access tokens from a file with a token and a
+// user id separated by whitespace on every line. Empty lines and lines
+// starting with # are skipped.
+func LoadAccessTokens(path string) (*AccessTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tokens := &AccessTokens{make(map[string]user.Id)}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a user id", path, n)
+		}
+		tokens.users[fields[0]] = user.Id(fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Lookup returns the user the token belongs to and false if the token is not
+// valid. It can be used as the Lookup of a BearerAuthenticator.
+func (t *AccessTokens) Lookup(token string) (user.Id, bool) {
+	userId, ok := t.users[token]
+	return userId, ok
+}
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/websocket"
+	"gopkg.in/inconshreveable/log15.v2"
+
+	"github.com/opentarock/service-api/go/proto"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/authz"
+	"github.com/opentarock/service-lobby/lobby"
+)
+
+const (
+	// defaultHeartbeatInterval is the default interval between pings sent to
+	// the client.
+	defaultHeartbeatInterval = 15 * time.Second
+	// defaultHeartbeatTimeout is the default duration after which a connection
+	// that did not send any frame is closed.
+	defaultHeartbeatTimeout = 45 * time.Second
+	// defaultSessionTTL is the default duration events are kept for a user
+	// without any open connection so the session can be resumed.
+	defaultSessionTTL = 2 * time.Minute
+	// sessionBufferSize is the number of most recent events kept for resuming
+	// a session.
+	sessionBufferSize = 256
+	// connSendBufferSize is the number of frames that can be queued for a
+	// connection before it is considered too slow and closed.
+	connSendBufferSize = sessionBufferSize + 64
+)
+
+// Frame types used by the WebSocket protocol.
+const (
+	// Sent by the client.
+	frameRequest = "request"
+	// Sent by the server.
+	frameResponse     = "response"
+	frameEvent        = "event"
+	frameError        = "error"
+	frameSession      = "session"
+	frameResumeFailed = "resume_failed"
+	// Sent by both.
+	framePing = "ping"
+	framePong = "pong"
+)
+
+// wsFrame is a JSON frame sent in either direction over a WebSocket.
+type wsFrame struct {
+	Type string `json:"type"`
+	// Id is chosen by the client for a request and repeated in the matching
+	// response or error.
+	Id uint64 `json:"id,omitempty"`
+	// Name is the operation name of requests and responses or the event name.
+	Name string `json:"name,omitempty"`
+	// Seq is the sequence number of an event within the user's session.
+	// Session and resume_failed frames carry the sequence number of the
+	// latest event.
+	Seq   uint64          `json:"seq,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// wsSession holds the recent events of a user so a client can resume after
+// reconnecting without missing events.
+type wsSession struct {
+	seq      uint64
+	events   []wsFrame
+	conns    map[*wsConn]bool
+	detached time.Time
+}
+
+// push assigns the next sequence number to an event, stores it and sends it
+// to all the open connections.
+func (s *wsSession) push(name string, data json.RawMessage) {
+	s.seq++
+	frame := wsFrame{Type: frameEvent, Seq: s.seq, Name: name, Data: data}
+	s.events = append(s.events, frame)
+	if len(s.events) > sessionBufferSize {
+		s.events = s.events[len(s.events)-sessionBufferSize:]
+	}
+	for c := range s.conns {
+		c.enqueue(frame)
+	}
+}
+
+// wsConn is a single client connection.
+type wsConn struct {
+	ws        *websocket.Conn
+	send      chan wsFrame
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+// enqueue queues a frame for sending without blocking. If the queue is full
+// the client is not keeping up and the connection is closed.
+func (c *wsConn) enqueue(frame wsFrame) {
+	select {
+	case c.send <- frame:
+	default:
+		c.close()
+	}
+}
+
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.ws.Close()
+	})
+}
+
+// websocketGateway serves the lobby API and lobby events over WebSocket
+// connections.
+//
+// Clients send request frames naming an operation and receive the response
+// and all the events concerning them as JSON frames on the same connection.
+// Every event has a sequence number and a client that reconnects with the
+// last_seq query parameter receives the events it missed. If they are no
+// longer available a resume_failed frame is sent and the client should
+// fetch the lobby state again.
+type websocketGateway struct {
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+	SessionTTL        time.Duration
+	// AllowedOrigins are the origins of the web pages allowed to connect,
+	// e.g. https://example.com. If empty only pages served from the
+	// gateway's own host are allowed. Clients that aren't browsers send no
+	// origin and are always allowed.
+	AllowedOrigins []string
+	auth           Authenticator
+	roomList       *lobby.RoomList
+	operations     map[string]operation
+	sessions       map[user.Id]*wsSession
+	logger         log15.Logger
+	stop           chan struct{}
+	stopOnce       *sync.Once
+	lock           *sync.Mutex
+}
+
+// errOriginNotAllowed is returned by the handshake of a connection from a web
+// page whose origin is not allowed.
+var errOriginNotAllowed = errors.New("Origin not allowed")
+
+// NewWebsocketGateway returns a new gateway that receives events from the
+// lobby and identifies users with auth. Browsers can't set headers on
+// WebSocket requests so auth should accept the access_token query parameter.
+func NewWebsocketGateway(handlers *lobbyServiceHandlers, auth Authenticator) *websocketGateway {
+	g := &websocketGateway{
+		HeartbeatInterval: defaultHeartbeatInterval,
+		HeartbeatTimeout:  defaultHeartbeatTimeout,
+		SessionTTL:        defaultSessionTTL,
+		auth:              auth,
+		roomList:          handlers.roomList,
+		operations:        make(map[string]operation),
+		sessions:          make(map[user.Id]*wsSession),
+		logger:            log15.New("service_name", serviceName, "transport", "websocket"),
+		stop:              make(chan struct{}),
+		stopOnce:          new(sync.Once),
+		lock:              new(sync.Mutex),
+	}
+	for _, op := range handlers.operations() {
+		g.operations[op.name] = op
+	}
+	handlers.roomList.AddEventListener(g.publish)
+	go g.expireSessions()
+	return g
+}
+
+// Close closes all the connections and stops expiring sessions.
+func (g *websocketGateway) Close() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+	})
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, s := range g.sessions {
+		for c := range s.conns {
+			c.close()
+		}
+	}
+}
+
+func (g *websocketGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userId, err := g.auth.Authenticate(r)
+	if err != nil {
+		g.logger.Error("Request not authenticated", "error", err)
+		writeJsonError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	resume := false
+	var lastSeq uint64
+	if s := r.URL.Query().Get("last_seq"); s != "" {
+		lastSeq, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			writeJsonError(w, http.StatusBadRequest, "Invalid last_seq")
+			return
+		}
+		resume = true
+	}
+	server := websocket.Server{
+		Handshake: g.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			g.serve(ws, userId, resume, lastSeq)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkOrigin refuses connections from web pages whose origin is not allowed,
+// otherwise any page the user visits could use their access token.
+func (g *websocketGateway) checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	config.Origin = u
+	if len(g.AllowedOrigins) == 0 {
+		if !strings.EqualFold(u.Host, r.Host) {
+			g.logger.Warn("Connection from another origin refused", "origin", origin)
+			return errOriginNotAllowed
+		}
+		return nil
+	}
+	for _, allowed := range g.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), u.Scheme+"://"+u.Host) {
+			return nil
+		}
+	}
+	g.logger.Warn("Connection from another origin refused", "origin", origin)
+	return errOriginNotAllowed
+}
+
+// serve handles a connection until it is closed or the client stops
+// responding.
+func (g *websocketGateway) serve(ws *websocket.Conn, userId user.Id, resume bool, lastSeq uint64) {
+	ws.MaxPayloadBytes = maxRequestBodySize
+	c := &wsConn{
+		ws:        ws,
+		send:      make(chan wsFrame, connSendBufferSize),
+		closed:    make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+	logger := g.logger.New("user_id", userId)
+	logger.Info("Client connected", "resume", resume, "last_seq", lastSeq)
+	g.attach(userId, c, resume, lastSeq)
+	defer g.detach(userId, c)
+	defer c.close()
+	// Every connection counts as a session for the player's presence.
+	g.roomList.Connected(userId)
+	defer g.roomList.Disconnected(userId)
+	go g.write(c)
+
+	for {
+		ws.SetReadDeadline(time.Now().Add(g.HeartbeatTimeout))
+		var frame wsFrame
+		if err := websocket.JSON.Receive(ws, &frame); err != nil {
+			logger.Info("Client disconnected", "error", err)
+			return
+		}
+		switch frame.Type {
+		case frameRequest:
+			c.enqueue(g.request(logger, userId, frame))
+		case framePing:
+			c.enqueue(wsFrame{Type: framePong})
+		case framePong:
+			// Receiving the frame already extended the read deadline.
+		default:
+			c.enqueue(wsFrame{Type: frameError, Id: frame.Id, Error: "Unknown frame type"})
+		}
+	}
+}
+
+// write sends queued frames and heartbeats until the connection is closed.
+func (g *websocketGateway) write(c *wsConn) {
+	ticker := time.NewTicker(g.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		var frame wsFrame
+		select {
+		case frame = <-c.send:
+		case <-ticker.C:
+			frame = wsFrame{Type: framePing}
+		case <-c.closed:
+			return
+		}
+		if err := websocket.JSON.Send(c.ws, frame); err != nil {
+			c.close()
+			return
+		}
+	}
+}
+
+// request runs the operation named in the request frame and returns the
+// response frame.
+func (g *websocketGateway) request(logger log15.Logger, userId user.Id, frame wsFrame) wsFrame {
+	op, ok := g.operations[frame.Name]
+	if !ok {
+		return wsFrame{Type: frameError, Id: frame.Id, Error: "Unknown request"}
+	}
+	request := op.newRequest()
+	if len(frame.Data) > 0 {
+		if err := json.Unmarshal(frame.Data, request); err != nil {
+			logger.Error("Malformed request", "error", err, "msg_type", request.GetMessageType())
+			return wsFrame{Type: frameError, Id: frame.Id, Error: "Malformed request"}
+		}
+	}
+	response, err := op.run(logger, userId, request)
+	if err == ErrRateLimited {
+		return wsFrame{Type: frameError, Id: frame.Id, Error: "Rate limit exceeded"}
+	} else if err == authz.ErrPermissionDenied {
+		return wsFrame{Type: frameError, Id: frame.Id, Error: "Permission denied"}
+	} else if err != nil {
+		return wsFrame{Type: frameError, Id: frame.Id, Error: "Internal error"}
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		logger.Error("Error encoding response", "error", err)
+		return wsFrame{Type: frameError, Id: frame.Id, Error: "Internal error"}
+	}
+	return wsFrame{Type: frameResponse, Id: frame.Id, Name: frame.Name, Data: data}
+}
+
+// attach adds a connection to the user's session creating it if necessary.
+// If resume is true events after lastSeq are sent to the connection before
+// any new event.
+func (g *websocketGateway) attach(userId user.Id, c *wsConn, resume bool, lastSeq uint64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	s, ok := g.sessions[userId]
+	if !ok {
+		s = &wsSession{conns: make(map[*wsConn]bool)}
+		g.sessions[userId] = s
+	}
+	s.conns[c] = true
+	if !resume {
+		c.enqueue(wsFrame{Type: frameSession, Seq: s.seq})
+		return
+	}
+	// Events lastSeq+1 up to s.seq must still be buffered.
+	oldest := s.seq + 1
+	if len(s.events) > 0 {
+		oldest = s.events[0].Seq
+	}
+	if lastSeq > s.seq || lastSeq+1 < oldest {
+		c.enqueue(wsFrame{Type: frameResumeFailed, Seq: s.seq})
+		return
+	}
+	c.enqueue(wsFrame{Type: frameSession, Seq: lastSeq})
+	for _, frame := range s.events {
+		if frame.Seq > lastSeq {
+			c.enqueue(frame)
+		}
+	}
+}
+
+// detach removes a connection from the user's session.
+func (g *websocketGateway) detach(userId user.Id, c *wsConn) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if s, ok := g.sessions[userId]; ok {
+		delete(s.conns, c)
+		if len(s.conns) == 0 {
+			s.detached = time.Now()
+		}
+	}
+}
+
+// publish is the lobby event listener that sends events to the sessions of
+// the users concerned.
+func (g *websocketGateway) publish(msg proto.ProtobufMessage, users []user.Id) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		g.logger.Error("Error encoding event", "error", err, "msg_type", msg.GetMessageType())
+		return
+	}
+	name := eventName(msg)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(users) == 0 {
+		for _, s := range g.sessions {
+			s.push(name, data)
+		}
+		return
+	}
+	for _, userId := range users {
+		if s, ok := g.sessions[userId]; ok {
+			s.push(name, data)
+		}
+	}
+}
+
+// expireSessions periodically removes sessions that had no connection for
+// longer than SessionTTL.
+func (g *websocketGateway) expireSessions() {
+	ticker := time.NewTicker(g.SessionTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.stop:
+			return
+		}
+		g.lock.Lock()
+		for userId, s := range g.sessions {
+			if len(s.conns) == 0 && time.Since(s.detached) > g.SessionTTL {
+				delete(g.sessions, userId)
+			}
+		}
+		g.lock.Unlock()
+	}
+}
+
+// eventName converts the event message type name to the name used in event
+// frames, for example JoinRoomEvent becomes join_room.
+func eventName(msg proto.ProtobufMessage) string {
+	name := strings.TrimSuffix(reflect.TypeOf(msg).Elem().Name(), "Event")
+	result := make([]rune, 0, len(name)+4)
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				result = append(result, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
@@ -0,0 +1,225 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pbuf "code.google.com/p/gogoprotobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"github.com/opentarock/service-api/go/proto_lobby"
+	"github.com/opentarock/service-api/go/user"
+	"github.com/opentarock/service-lobby/config"
+	"github.com/opentarock/service-lobby/service"
+)
+
+type frame struct {
+	Type  string          `json:"type"`
+	Id    uint64          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Seq   uint64          `json:"seq,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func makeWebsocketGateway(t *testing.T, heartbeat time.Duration, allowedOrigins ...string) *httptest.Server {
+	conf, err := config.NewManager("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := service.NewLobbyServiceHandlers(nil, conf)
+	gateway := service.NewWebsocketGateway(handlers, service.BearerAuthenticator{Lookup: lookupToken})
+	gateway.HeartbeatInterval = heartbeat
+	gateway.AllowedOrigins = allowedOrigins
+	return httptest.NewServer(gateway)
+}
+
+// lookupToken accepts the tokens of the form token-<user id>.
+func lookupToken(token string) (user.Id, bool) {
+	if !strings.HasPrefix(token, "token-") {
+		return "", false
+	}
+	return user.Id(strings.TrimPrefix(token, "token-")), true
+}
+
+// dial connects as the user from a page served by the gateway, the query is
+// added to the url.
+func dial(t *testing.T, server *httptest.Server, userId user.Id, query string) (*websocket.Conn, error) {
+	return dialFrom(t, server, server.URL, userId, query)
+}
+
+// dialFrom connects as the user from a page with the origin.
+func dialFrom(t *testing.T, server *httptest.Server, origin string, userId user.Id, query string) (*websocket.Conn, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?" + query
+	if userId != "" {
+		url += "&access_token=token-" + userId.String()
+	}
+	wsConfig, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return websocket.DialConfig(wsConfig)
+}
+
+func mustDial(t *testing.T, server *httptest.Server, userId user.Id, query string) *websocket.Conn {
+	ws, err := dial(t, server, userId, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func receive(t *testing.T, ws *websocket.Conn) frame {
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var f frame
+	if err := websocket.JSON.Receive(ws, &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// receiveType skips frames until a frame of type frameType is received.
+func receiveType(t *testing.T, ws *websocket.Conn, frameType string) frame {
+	for {
+		if f := receive(t, ws); f.Type == frameType {
+			return f
+		}
+	}
+}
+
+func sendRequest(t *testing.T, ws *websocket.Conn, id uint64, name string, request interface{}) {
+	data, _ := json.Marshal(request)
+	err := websocket.JSON.Send(ws, frame{Type: "request", Id: id, Name: name, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebsocketRequestResponse(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+	ws := mustDial(t, server, "1", "")
+	defer ws.Close()
+
+	assert.Equal(t, "session", receive(t, ws).Type)
+	sendRequest(t, ws, 7, "create_room", &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")})
+	f := receiveType(t, ws, "response")
+	assert.Equal(t, 7, f.Id)
+	assert.Equal(t, "create_room", f.Name)
+	var response proto_lobby.CreateRoomResponse
+	assert.Nil(t, json.Unmarshal(f.Data, &response))
+	assert.Equal(t, "room", response.GetRoom().GetName())
+}
+
+func TestWebsocketUnknownRequest(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+	ws := mustDial(t, server, "1", "")
+	defer ws.Close()
+
+	sendRequest(t, ws, 3, "no_such_request", nil)
+	f := receiveType(t, ws, "error")
+	assert.Equal(t, 3, f.Id)
+}
+
+func TestWebsocketReceivesEvents(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+	owner := mustDial(t, server, "1", "")
+	defer owner.Close()
+	player := mustDial(t, server, "2", "")
+	defer player.Close()
+	receiveType(t, owner, "session")
+	receiveType(t, player, "session")
+
+	sendRequest(t, owner, 1, "create_room", &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")})
+	created := receiveType(t, player, "event")
+	assert.Equal(t, "room_created", created.Name)
+	assert.Equal(t, 1, created.Seq)
+	var createdEvent proto_lobby.RoomCreatedEvent
+	json.Unmarshal(created.Data, &createdEvent)
+
+	sendRequest(t, player, 1, "join_room", &proto_lobby.JoinRoomRequest{RoomId: createdEvent.GetRoom().Id})
+	receiveType(t, owner, "event")
+	joined := receiveType(t, owner, "event")
+	assert.Equal(t, "join_room", joined.Name)
+	assert.Equal(t, 2, joined.Seq)
+}
+
+func TestWebsocketSessionCanBeResumed(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+	owner := mustDial(t, server, "1", "")
+	receiveType(t, owner, "session")
+	sendRequest(t, owner, 1, "create_room", &proto_lobby.CreateRoomRequest{Name: pbuf.String("room")})
+	created := receiveType(t, owner, "event")
+	owner.Close()
+
+	var createdEvent proto_lobby.RoomCreatedEvent
+	json.Unmarshal(created.Data, &createdEvent)
+	player := mustDial(t, server, "2", "")
+	defer player.Close()
+	sendRequest(t, player, 1, "join_room", &proto_lobby.JoinRoomRequest{RoomId: createdEvent.GetRoom().Id})
+	receiveType(t, player, "response")
+
+	owner = mustDial(t, server, "1", "last_seq=1")
+	defer owner.Close()
+	assert.Equal(t, "session", receive(t, owner).Type)
+	missed := receive(t, owner)
+	assert.Equal(t, "event", missed.Type)
+	assert.Equal(t, "join_room", missed.Name, "Events sent while disconnected are replayed")
+	assert.Equal(t, 2, missed.Seq)
+}
+
+func TestWebsocketResumeFromUnknownSequenceFails(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+	ws := mustDial(t, server, "1", "last_seq=10")
+	defer ws.Close()
+
+	assert.Equal(t, "resume_failed", receive(t, ws).Type)
+}
+
+func TestWebsocketSendsHeartbeats(t *testing.T) {
+	server := makeWebsocketGateway(t, 20*time.Millisecond)
+	defer server.Close()
+	ws := mustDial(t, server, "1", "")
+	defer ws.Close()
+
+	receiveType(t, ws, "ping")
+	err := websocket.JSON.Send(ws, frame{Type: "ping"})
+	assert.Nil(t, err)
+	receiveType(t, ws, "pong")
+}
+
+func TestWebsocketRequiresAuthentication(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+
+	_, err := dial(t, server, "", "")
+	assert.NotNil(t, err)
+}
+
+func TestWebsocketRefusesOtherOrigins(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute)
+	defer server.Close()
+
+	_, err := dialFrom(t, server, "http://evil.example.com/", "1", "")
+	assert.NotNil(t, err)
+}
+
+func TestWebsocketAcceptsAllowedOrigins(t *testing.T) {
+	server := makeWebsocketGateway(t, time.Minute, "https://example.com")
+	defer server.Close()
+
+	ws, err := dialFrom(t, server, "https://example.com/", "1", "")
+	if assert.Nil(t, err) {
+		ws.Close()
+	}
+	_, err = dial(t, server, "1", "")
+	assert.NotNil(t, err, "Only the allowed origins can connect")
+}
@@ -9,26 +9,34 @@ import (
 type CancellableTimeout struct {
 	cancelled bool
 	lock      *sync.Mutex
-	cancel    chan<- struct{}
+	timer     Timer
 }
 
 // StartCancellableTimeout starts a new timeout with duration and function f
 // that is executed if timeout occurs.
 func StartCancellableTimeout(duration time.Duration, f func()) *CancellableTimeout {
-	cancel := make(chan struct{}, 1)
-	go func() {
-		select {
-		case <-cancel:
-			break
-		case <-time.After(duration):
-			f()
-		}
-	}()
-	return &CancellableTimeout{
-		cancel:    cancel,
+	return StartCancellableTimeoutWithClock(RealClock(), duration, f)
+}
+
+// StartCancellableTimeoutWithClock starts a new timeout measured by clock.
+func StartCancellableTimeoutWithClock(clock Clock, duration time.Duration, f func()) *CancellableTimeout {
+	t := &CancellableTimeout{
 		cancelled: false,
 		lock:      new(sync.Mutex),
 	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.timer = clock.AfterFunc(duration, func() {
+		t.lock.Lock()
+		if t.cancelled {
+			t.lock.Unlock()
+			return
+		}
+		t.cancelled = true
+		t.lock.Unlock()
+		f()
+	})
+	return t
 }
 
 // Cancel cancels a timeout. In the case of timeout happening concurrently
@@ -37,6 +45,7 @@ func (t *CancellableTimeout) Cancel() {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 	if !t.cancelled {
-		t.cancel <- struct{}{}
+		t.timer.Stop()
+		t.cancelled = true
 	}
 }
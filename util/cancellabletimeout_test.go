@@ -10,32 +10,65 @@ import (
 
 const timeoutDuration = 50 * time.Millisecond
 
+func makeClock() *util.FakeClock {
+	return util.NewFakeClock(time.Unix(0, 0))
+}
+
 func TestTimeoutFunctionIsCalledOnTimeout(t *testing.T) {
+	clock := makeClock()
 	called := false
-	util.StartCancellableTimeout(timeoutDuration, func() {
+	util.StartCancellableTimeoutWithClock(clock, timeoutDuration, func() {
 		called = true
 	})
-	time.Sleep(timeoutDuration * 2)
+	clock.Advance(timeoutDuration - 1)
+	assert.False(t, called)
+	clock.Advance(1)
 	assert.True(t, called)
 }
 
 func TestTimeoutCanBeCancelled(t *testing.T) {
+	clock := makeClock()
 	called := false
-	ct := util.StartCancellableTimeout(timeoutDuration, func() {
+	ct := util.StartCancellableTimeoutWithClock(clock, timeoutDuration, func() {
 		called = true
 	})
 	ct.Cancel()
-	time.Sleep(timeoutDuration * 2)
+	clock.Advance(timeoutDuration * 2)
 	assert.False(t, called)
+	assert.Equal(t, 0, clock.NumTimers())
 }
 
 func TestTimeoutCanBeCancelledMultipleTimes(t *testing.T) {
+	clock := makeClock()
 	called := false
-	ct := util.StartCancellableTimeout(timeoutDuration, func() {
+	ct := util.StartCancellableTimeoutWithClock(clock, timeoutDuration, func() {
 		called = true
 	})
 	ct.Cancel()
 	ct.Cancel()
-	time.Sleep(timeoutDuration * 2)
+	clock.Advance(timeoutDuration * 2)
 	assert.False(t, called)
 }
+
+func TestTimeoutCanBeCancelledAfterItHappened(t *testing.T) {
+	clock := makeClock()
+	calls := 0
+	ct := util.StartCancellableTimeoutWithClock(clock, timeoutDuration, func() {
+		calls++
+	})
+	clock.Advance(timeoutDuration)
+	ct.Cancel()
+	assert.Equal(t, 1, calls)
+}
+
+func TestTimeoutWithRealClock(t *testing.T) {
+	called := make(chan struct{})
+	util.StartCancellableTimeout(time.Millisecond, func() {
+		close(called)
+	})
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout function should be called")
+	}
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by timeouts so that tests can control
+// the passing of time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f after duration d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event scheduled with Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or has been stopped.
+	Stop() bool
+}
+
+// RealClock returns a Clock using the system time.
+func RealClock() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a Clock that only moves when it is advanced manually.
+// Timers that expire are fired synchronously by Advance, in the order of
+// their deadlines.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	lock   *sync.Mutex
+}
+
+// NewFakeClock returns a FakeClock set to time now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:  now,
+		lock: new(sync.Mutex),
+	}
+}
+
+// Now returns the current time of the fake clock.
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f to be called when the clock is advanced by at least
+// duration d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTimer{
+		clock:    c,
+		deadline: c.now.Add(d),
+		f:        f,
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by duration d and fires all the timers
+// that expire in the meantime.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	end := c.now.Add(d)
+	c.lock.Unlock()
+	for {
+		c.lock.Lock()
+		t := c.nextExpired(end)
+		if t == nil {
+			c.now = end
+			c.lock.Unlock()
+			return
+		}
+		if t.deadline.After(c.now) {
+			c.now = t.deadline
+		}
+		c.lock.Unlock()
+		// Timers are fired without holding the lock so they can schedule new
+		// timers.
+		t.f()
+	}
+}
+
+// NumTimers returns the number of timers that are waiting to fire.
+func (c *FakeClock) NumTimers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+// nextExpired removes and returns the earliest timer expiring before end,
+// or nil if there is none.
+// This method should only be called while owning the clock's lock.
+func (c *FakeClock) nextExpired(end time.Time) *fakeTimer {
+	if len(c.timers) == 0 {
+		return nil
+	}
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+	t := c.timers[0]
+	if t.deadline.After(end) {
+		return nil
+	}
+	c.timers = c.timers[1:]
+	return t
+}
+
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	f        func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t)
+}
@@ -0,0 +1,57 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClockOnlyMovesWhenAdvanced(t *testing.T) {
+	clock := makeClock()
+	start := clock.Now()
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), clock.Now())
+}
+
+func TestFakeClockFiresTimersInOrder(t *testing.T) {
+	clock := makeClock()
+	var fired []int
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+	clock.AfterFunc(3*time.Second, func() { fired = append(fired, 3) })
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, []int{1, 2}, fired)
+	assert.Equal(t, 1, clock.NumTimers())
+}
+
+func TestFakeClockTimerSeesItsDeadline(t *testing.T) {
+	clock := makeClock()
+	start := clock.Now()
+	var firedAt time.Time
+	clock.AfterFunc(time.Second, func() { firedAt = clock.Now() })
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Second), firedAt)
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+}
+
+func TestFakeClockFiresTimersScheduledByTimers(t *testing.T) {
+	clock := makeClock()
+	calls := 0
+	clock.AfterFunc(time.Second, func() {
+		calls++
+		clock.AfterFunc(time.Second, func() { calls++ })
+	})
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, 2, calls)
+}
+
+func TestStoppedTimerDoesNotFire(t *testing.T) {
+	clock := makeClock()
+	called := false
+	timer := clock.AfterFunc(time.Second, func() { called = true })
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+	clock.Advance(time.Second)
+	assert.False(t, called)
+}
@@ -0,0 +1,196 @@
+package util
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Scheduler runs functions at a later time using a single underlying timer
+// for all of them, instead of one goroutine and timer per timeout.
+// Pending tasks are kept in a heap ordered by their deadline and the
+// underlying timer is always armed for the earliest one.
+//
+// Scheduler implements Clock so it can be used wherever a clock is expected.
+// Tasks are run sequentially so they should not block.
+type Scheduler struct {
+	clock Clock
+	tasks taskHeap
+	seq   uint64
+	timer Timer
+	// armed is the deadline the underlying timer is armed for.
+	armed time.Time
+	// gen identifies the currently armed timer so a stopped timer that fires
+	// anyway does not interfere with the new one.
+	gen  uint64
+	lock *sync.Mutex
+}
+
+// ScheduledTask is a function scheduled to run with a Scheduler.
+type ScheduledTask struct {
+	scheduler *Scheduler
+	deadline  time.Time
+	seq       uint64
+	f         func()
+	// index is the position of the task in the heap or -1 if it is not
+	// scheduled.
+	index int
+}
+
+// NewScheduler returns a new Scheduler that measures time with clock.
+func NewScheduler(clock Clock) *Scheduler {
+	return &Scheduler{
+		clock: clock,
+		lock:  new(sync.Mutex),
+	}
+}
+
+// Now returns the current time of the scheduler's clock.
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now()
+}
+
+// AfterFunc schedules f to run after duration d.
+func (s *Scheduler) AfterFunc(d time.Duration, f func()) Timer {
+	return s.Schedule(d, f)
+}
+
+// Schedule schedules f to run after duration d. Tasks with the same deadline
+// run in the order they were scheduled.
+func (s *Scheduler) Schedule(d time.Duration, f func()) *ScheduledTask {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seq++
+	t := &ScheduledTask{
+		scheduler: s,
+		deadline:  s.clock.Now().Add(d),
+		seq:       s.seq,
+		f:         f,
+	}
+	heap.Push(&s.tasks, t)
+	s.arm()
+	return t
+}
+
+// Len returns the number of pending tasks.
+func (s *Scheduler) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.tasks)
+}
+
+// Stop cancels the task. It returns false if the task has already run or
+// has been stopped.
+func (t *ScheduledTask) Stop() bool {
+	s := t.scheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&s.tasks, t.index)
+	s.arm()
+	return true
+}
+
+// Reschedule moves the task to run after duration d from now. It returns
+// false and does nothing if the task has already run or has been stopped.
+func (t *ScheduledTask) Reschedule(d time.Duration) bool {
+	s := t.scheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if t.index < 0 {
+		return false
+	}
+	t.deadline = s.clock.Now().Add(d)
+	heap.Fix(&s.tasks, t.index)
+	s.arm()
+	return true
+}
+
+// Deadline returns the time the task is scheduled to run.
+func (t *ScheduledTask) Deadline() time.Time {
+	t.scheduler.lock.Lock()
+	defer t.scheduler.lock.Unlock()
+	return t.deadline
+}
+
+// arm makes sure the underlying timer fires at the earliest deadline.
+// This method should only be called while owning the scheduler's lock.
+func (s *Scheduler) arm() {
+	if len(s.tasks) == 0 {
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		return
+	}
+	next := s.tasks[0].deadline
+	if s.timer != nil && s.armed.Equal(next) {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.gen++
+	gen := s.gen
+	s.armed = next
+	s.timer = s.clock.AfterFunc(next.Sub(s.clock.Now()), func() {
+		s.fire(gen)
+	})
+}
+
+// fire runs all the tasks that are due and rearms the timer.
+func (s *Scheduler) fire(gen uint64) {
+	s.lock.Lock()
+	if gen == s.gen {
+		s.timer = nil
+	}
+	now := s.clock.Now()
+	var due []*ScheduledTask
+	for len(s.tasks) > 0 && !s.tasks[0].deadline.After(now) {
+		due = append(due, heap.Pop(&s.tasks).(*ScheduledTask))
+	}
+	s.arm()
+	s.lock.Unlock()
+	// Tasks are run without holding the lock so they can schedule new tasks.
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// taskHeap implements heap.Interface ordering tasks by deadline.
+type taskHeap []*ScheduledTask
+
+func (h taskHeap) Len() int {
+	return len(h)
+}
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].deadline.Equal(h[j].deadline) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].deadline.Before(h[j].deadline)
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*ScheduledTask)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*h = old[:n-1]
+	return t
+}
@@ -0,0 +1,173 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-lobby/util"
+)
+
+func TestSchedulerRunsTasksInDeadlineOrder(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	var ran []int
+	s.Schedule(2*time.Second, func() { ran = append(ran, 2) })
+	s.Schedule(time.Second, func() { ran = append(ran, 1) })
+	s.Schedule(time.Second, func() { ran = append(ran, 3) })
+	clock.Advance(time.Second)
+	assert.Equal(t, []int{1, 3}, ran, "Tasks with equal deadlines run in the order they were scheduled")
+	clock.Advance(time.Second)
+	assert.Equal(t, []int{1, 3, 2}, ran)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSchedulerUsesSingleTimer(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	for i := 1; i <= 100; i++ {
+		s.Schedule(time.Duration(i)*time.Second, func() {})
+	}
+	assert.Equal(t, 1, clock.NumTimers())
+	assert.Equal(t, 100, s.Len())
+}
+
+func TestScheduledTaskCanBeStopped(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	called := false
+	task := s.Schedule(time.Second, func() { called = true })
+	assert.True(t, task.Stop())
+	assert.False(t, task.Stop())
+	clock.Advance(time.Second)
+	assert.False(t, called)
+	assert.Equal(t, 0, clock.NumTimers(), "Timer is stopped when no tasks are pending")
+}
+
+func TestScheduledTaskCanBeRescheduled(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	called := false
+	task := s.Schedule(time.Second, func() { called = true })
+	clock.Advance(500 * time.Millisecond)
+	assert.True(t, task.Reschedule(time.Second))
+	clock.Advance(900 * time.Millisecond)
+	assert.False(t, called, "Deadline is moved relative to the time of rescheduling")
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, called)
+	assert.False(t, task.Reschedule(time.Second), "Task that ran can't be rescheduled")
+}
+
+func TestRescheduleToEarlierDeadline(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	called := false
+	task := s.Schedule(time.Minute, func() { called = true })
+	task.Reschedule(time.Second)
+	clock.Advance(time.Second)
+	assert.True(t, called)
+}
+
+func TestTaskCanScheduleAnotherTask(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	calls := 0
+	s.Schedule(time.Second, func() {
+		calls++
+		s.Schedule(time.Second, func() { calls++ })
+	})
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCancellableTimeoutWithScheduler(t *testing.T) {
+	clock := makeClock()
+	s := util.NewScheduler(clock)
+	called := false
+	ct := util.StartCancellableTimeoutWithClock(s, time.Second, func() { called = true })
+	ct.Cancel()
+	clock.Advance(time.Second)
+	assert.False(t, called)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSchedulerWithRealClock(t *testing.T) {
+	s := util.NewScheduler(util.RealClock())
+	done := make(chan int, 2)
+	s.Schedule(2*time.Millisecond, func() { done <- 2 })
+	s.Schedule(time.Millisecond, func() { done <- 1 })
+	for _, expected := range []int{1, 2} {
+		select {
+		case n := <-done:
+			assert.Equal(t, expected, n)
+		case <-time.After(time.Second):
+			t.Fatal("Task should run")
+		}
+	}
+}
+
+// startGoroutineTimeout is the approach used before the scheduler, one
+// goroutine and timer per timeout.
+func startGoroutineTimeout(d time.Duration, f func()) chan<- struct{} {
+	cancel := make(chan struct{}, 1)
+	go func() {
+		select {
+		case <-cancel:
+		case <-time.After(d):
+			f()
+		}
+	}()
+	return cancel
+}
+
+func BenchmarkGoroutineTimeoutStartCancel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		cancel := startGoroutineTimeout(time.Hour, func() {})
+		cancel <- struct{}{}
+	}
+}
+
+func BenchmarkSchedulerStartCancel(b *testing.B) {
+	s := util.NewScheduler(util.RealClock())
+	for i := 0; i < b.N; i++ {
+		s.Schedule(time.Hour, func() {}).Stop()
+	}
+}
+
+func BenchmarkGoroutineTimeoutPending(b *testing.B) {
+	cancels := make([]chan<- struct{}, 0, b.N)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cancels = append(cancels, startGoroutineTimeout(time.Hour+time.Duration(i), func() {}))
+	}
+	b.StopTimer()
+	for _, cancel := range cancels {
+		cancel <- struct{}{}
+	}
+}
+
+func BenchmarkSchedulerPending(b *testing.B) {
+	s := util.NewScheduler(util.RealClock())
+	tasks := make([]*util.ScheduledTask, 0, b.N)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tasks = append(tasks, s.Schedule(time.Hour+time.Duration(i), func() {}))
+	}
+	b.StopTimer()
+	for _, task := range tasks {
+		task.Stop()
+	}
+}
+
+func BenchmarkSchedulerReschedule(b *testing.B) {
+	s := util.NewScheduler(util.RealClock())
+	for i := 0; i < 10000; i++ {
+		s.Schedule(time.Hour+time.Duration(i), func() {})
+	}
+	task := s.Schedule(time.Hour, func() {})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		task.Reschedule(time.Hour + time.Duration(i%20000))
+	}
+}
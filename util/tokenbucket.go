@@ -0,0 +1,50 @@
+package util
+
+import "time"
+
+// TokenBucket limits the rate of events to Rate per second on average while
+// allowing bursts of up to Burst events.
+// It is not safe for concurrent use.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket.
+func NewTokenBucket(rate float64, burst uint, now time.Time) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// Take takes a token from the bucket if one is available.
+func (b *TokenBucket) Take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// IsFull returns true if the bucket has been refilled completely, in which
+// case it is equivalent to a new bucket.
+func (b *TokenBucket) IsFull(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
@@ -0,0 +1,39 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/opentarock/service-lobby/util"
+)
+
+func TestTokenBucketAllowsBurst(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := util.NewTokenBucket(1, 3, now)
+	assert.True(t, b.Take(now))
+	assert.True(t, b.Take(now))
+	assert.True(t, b.Take(now))
+	assert.False(t, b.Take(now))
+}
+
+func TestTokenBucketRefillsAtRate(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := util.NewTokenBucket(2, 1, now)
+	assert.True(t, b.Take(now))
+	assert.False(t, b.Take(now.Add(400*time.Millisecond)))
+	assert.True(t, b.Take(now.Add(500*time.Millisecond)))
+}
+
+func TestTokenBucketDoesNotExceedBurst(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := util.NewTokenBucket(1, 2, now)
+	b.Take(now)
+	assert.False(t, b.IsFull(now))
+	later := now.Add(time.Hour)
+	assert.True(t, b.IsFull(later))
+	assert.True(t, b.Take(later))
+	assert.True(t, b.Take(later))
+	assert.False(t, b.Take(later))
+}